@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/j6n/anolis/irc"
 )
@@ -17,26 +20,42 @@ func main() {
 	conf := irc.NewConfiguration()
 	// turn on verbose logging
 	// conf.Verbose = true
+	// connect over tls
+	// conf.TLS, conf.Port = true, 6697
+	// authenticate with sasl
+	// conf.SASLMechanism, conf.SASLUsername, conf.SASLPassword = "PLAIN", "anolis", "hunter2"
+	// try another nick if ours is taken, and take it back when it frees up
+	// conf.AltNicknames, conf.RegainNick = []string{"anolis_bot"}, true
+	// redial the server if the connection drops
+	// conf.Reconnect = irc.NewReconnectPolicy()
 
 	// create and connect to irc with our configuration
-	conn := irc.Dial(conf)
+	conn, err := irc.Dial(conf)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	// join channels when we are fully connected
 	conn.Events().Add("001", func(m *irc.Message, ctx irc.Context) {
 		ctx.Commands().Join("#test")
 	})
 
-	// log when we receive a private emssage
-	conn.Events().Add("PRIVMSG", func(m *irc.Message, ctx irc.Context) {
-		log.Println(m)
+	// log when we receive a private message
+	conn.Events().OnPrivmsg(func(ev *irc.PrivmsgEvent, ctx irc.Context) {
+		log.Printf("<%s:%s> %s", ev.From, ev.Target, ev.Text)
 	})
 
 	go func() {
 		<-quit
-		// send the quit
-		conn.Commands().Quit("bye")
+		// send the quit, giving the server a few seconds to hang up
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn.Connection().Shutdown(ctx, "bye")
 	}()
 
 	// wait for the connection to close
 	<-conn.Connection().WaitForClose()
+	if err := conn.Connection().Err(); !errors.Is(err, irc.ErrQuit) {
+		log.Println(err)
+	}
 }
@@ -0,0 +1,191 @@
+package irc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Capabilities holds the IRCv3 capabilities the server offers,
+// and the ones that were enabled
+type Capabilities struct {
+	available map[string]string
+	enabled   map[string]bool
+	pending   int // REQs waiting for an ACK or NAK
+
+	sync.RWMutex
+}
+
+func newCapabilities() *Capabilities {
+	c := &Capabilities{}
+	c.reset()
+	return c
+}
+
+// Enabled returns whether the capability, name, is enabled
+func (c *Capabilities) Enabled(name string) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.enabled[name]
+}
+
+// Available returns the value of the capability, name, and whether the server offers it
+func (c *Capabilities) Available(name string) (value string, ok bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	value, ok = c.available[name]
+	return
+}
+
+// List returns the names of the enabled capabilities
+func (c *Capabilities) List() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	out := make([]string, 0, len(c.enabled))
+	for k := range c.enabled {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (c *Capabilities) reset() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.available = make(map[string]string)
+	c.enabled = make(map[string]bool)
+	c.pending = 0
+}
+
+// offer adds 'name[=value]' capabilities to those the server offers
+func (c *Capabilities) offer(caps []string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, tok := range caps {
+		name, value, _ := strings.Cut(tok, "=")
+		c.available[name] = value
+	}
+}
+
+// remove removes capabilities the server no longer offers
+func (c *Capabilities) remove(caps []string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, name := range caps {
+		delete(c.available, name)
+		delete(c.enabled, name)
+	}
+}
+
+// ack enables, or disables if prefixed with '-', the capabilities
+func (c *Capabilities) ack(caps []string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, name := range caps {
+		if strings.HasPrefix(name, "-") {
+			delete(c.enabled, name[1:])
+			continue
+		}
+		c.enabled[strings.TrimLeft(name, "~=")] = true
+	}
+}
+
+// wanted returns the capabilities in want the server offers that aren't enabled
+func (c *Capabilities) wanted(want []string) []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	var out []string
+	for _, name := range want {
+		if _, ok := c.available[name]; ok && !c.enabled[name] {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// capEvent negotiates capabilities with the server, during registration and after
+func (c *Connection) capEvent(msg *Message, ctx Context) {
+	// CAP <target> <subcommand> [*] :<caps>, '*' means the list continues
+	if len(msg.Params) < 3 {
+		return
+	}
+
+	more := len(msg.Params) > 3 && msg.Params[2] == "*"
+	list := lastString(msg.Params)
+	caps := strings.Fields(list)
+
+	switch strings.ToUpper(msg.Params[1]) {
+	case "LS":
+		c.caps.offer(caps)
+		if more || c.isRegistered() {
+			return
+		}
+		c.requestCaps()
+
+	case "NEW":
+		c.caps.offer(caps)
+		c.requestCaps()
+
+	case "DEL":
+		c.caps.remove(caps)
+
+	case "ACK":
+		log.Debugf("enabled capabilities: %s", list)
+		c.caps.ack(caps)
+		c.capAnswered()
+
+	case "NAK":
+		log.Warnf("server refused capabilities: %s", list)
+		c.capAnswered()
+	}
+}
+
+// requestCaps requests the configured capabilities the server offers,
+// ending the negotiation if there aren't any during registration
+func (c *Connection) requestCaps() {
+	want := c.conf.Capabilities
+	if c.conf.SASLMechanism != "" {
+		want = append(want[:len(want):len(want)], "sasl")
+	}
+
+	req := c.caps.wanted(want)
+	if len(req) == 0 {
+		c.finishCaps()
+		return
+	}
+
+	c.caps.Lock()
+	c.caps.pending++
+	c.caps.Unlock()
+
+	c.Raw("CAP REQ :%s", strings.Join(req, " "))
+}
+
+// capAnswered ends the negotiation once every REQ has been answered
+func (c *Connection) capAnswered() {
+	c.caps.Lock()
+	if c.caps.pending > 0 {
+		c.caps.pending--
+	}
+	done := c.caps.pending == 0
+	c.caps.Unlock()
+
+	if done {
+		c.finishCaps()
+	}
+}
+
+// endCaps ends the negotiation, if we are still registering
+func (c *Connection) endCaps() {
+	if !c.isRegistered() {
+		c.Raw("CAP END")
+	}
+}
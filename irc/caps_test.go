@@ -0,0 +1,63 @@
+package irc
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCapabilities(t *testing.T) {
+	Convey("capability negotiation should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.Capabilities = []string{"multi-prefix", "away-notify", "echo-message"}
+
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		client := srv.Accept()
+		So(client.Expect("CAP"), ShouldEqual, "CAP LS 302")
+
+		Convey("request the capabilities the server offers", func() {
+			client.Send(":irc.localhost CAP * LS * :multi-prefix sasl=PLAIN,EXTERNAL")
+			client.Send(":irc.localhost CAP * LS :away-notify")
+			So(client.Expect("CAP"), ShouldEqual, "CAP REQ :multi-prefix away-notify")
+
+			client.Send(":irc.localhost CAP * ACK :multi-prefix away-notify")
+			So(client.Expect("CAP"), ShouldEqual, "CAP END")
+
+			So(ctx.Caps().List(), ShouldResemble, []string{"away-notify", "multi-prefix"})
+			value, ok := ctx.Caps().Available("sasl")
+			So(ok, ShouldBeTrue)
+			So(value, ShouldEqual, "PLAIN,EXTERNAL")
+
+			Convey("and follow changes after registration", func() {
+				client.Send(":irc.localhost 001 anolis :Welcome")
+				client.Send(":irc.localhost CAP anolis NEW :echo-message")
+				So(client.Expect("CAP"), ShouldEqual, "CAP REQ :echo-message")
+
+				client.Send(":irc.localhost CAP anolis ACK :echo-message")
+				client.Send(":irc.localhost CAP anolis DEL :away-notify")
+				So(eventually(func() bool { return !ctx.Caps().Enabled("away-notify") }), ShouldBeTrue)
+				So(ctx.Caps().List(), ShouldResemble, []string{"echo-message", "multi-prefix"})
+			})
+		})
+
+		Convey("end negotiation when nothing is offered", func() {
+			client.Send(":irc.localhost CAP * LS :sasl")
+			So(client.Expect("CAP"), ShouldEqual, "CAP END")
+		})
+
+		Convey("end negotiation when the request is refused", func() {
+			client.Send(":irc.localhost CAP * LS :multi-prefix")
+			So(client.Expect("CAP"), ShouldEqual, "CAP REQ :multi-prefix")
+
+			client.Send(":irc.localhost CAP * NAK :multi-prefix")
+			So(client.Expect("CAP"), ShouldEqual, "CAP END")
+			So(ctx.Caps().Enabled("multi-prefix"), ShouldBeFalse)
+		})
+	})
+}
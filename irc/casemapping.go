@@ -0,0 +1,44 @@
+package irc
+
+import "strings"
+
+// FoldCase returns s folded with the named CASEMAPPING, so that two names
+// which the server considers equal fold to the same string.
+// Unknown mappings fall back to rfc1459, which is what servers assume without one
+func FoldCase(mapping, s string) string {
+	switch strings.ToLower(mapping) {
+	case "ascii":
+		return strings.Map(foldASCII, s)
+	case "strict-rfc1459":
+		return strings.Map(foldStrictRFC1459, s)
+	case "rfc7613":
+		// this doesn't apply the full PRECIS profile (NFKC and width mapping),
+		// only the unicode lowercasing, which covers the common cases
+		return strings.ToLower(s)
+	default:
+		return strings.Map(foldRFC1459, s)
+	}
+}
+
+func foldASCII(r rune) rune {
+	if 'A' <= r && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
+
+func foldStrictRFC1459(r rune) rune {
+	// []\ are the uppercase forms of {}|
+	if '[' <= r && r <= ']' {
+		return r + '{' - '['
+	}
+	return foldASCII(r)
+}
+
+func foldRFC1459(r rune) rune {
+	// and ^ is the uppercase form of ~
+	if r == '^' {
+		return '~'
+	}
+	return foldStrictRFC1459(r)
+}
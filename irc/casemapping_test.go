@@ -0,0 +1,40 @@
+package irc
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFoldCase(t *testing.T) {
+	Convey("fold case should", t, func() {
+		Convey("use rfc1459 by default", func() {
+			So(FoldCase("", "Foo[]\\^"), ShouldEqual, "foo{}|~")
+			So(FoldCase("rfc1459", "#Foo[]\\^"), ShouldEqual, "#foo{}|~")
+			So(FoldCase("unknown", "FOO^"), ShouldEqual, "foo~")
+		})
+
+		Convey("use strict-rfc1459", func() {
+			So(FoldCase("strict-rfc1459", "Foo[]\\^"), ShouldEqual, "foo{}|^")
+		})
+
+		Convey("use ascii", func() {
+			So(FoldCase("ascii", "Foo[]\\~"), ShouldEqual, "foo[]\\~")
+			So(FoldCase("ASCII", "ÀB"), ShouldEqual, "Àb")
+		})
+
+		Convey("use rfc7613", func() {
+			So(FoldCase("rfc7613", "ÀB[]"), ShouldEqual, "àb[]")
+		})
+	})
+
+	Convey("server info should fold with its casemapping", t, func() {
+		s := NewServerInfo()
+		So(s.EqualFold("foo[a]", "FOO{A}"), ShouldBeTrue)
+
+		msg, _ := ParseMessage(":irc.localhost 005 anolis CASEMAPPING=ascii :are supported by this server")
+		s.isupportEvent(msg, nil)
+		So(s.EqualFold("foo[a]", "FOO{A}"), ShouldBeFalse)
+		So(s.EqualFold("foo[a]", "FOO[A]"), ShouldBeTrue)
+	})
+}
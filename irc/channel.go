@@ -1,30 +1,116 @@
 package irc
 
 import (
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Channel represents an IRC channel
 type Channel struct {
 	Name, topic string
+	topicSetter string    // who set the topic, if we know
+	topicTime   time.Time // when the topic was set, if we know
 	users       *Users
+	names       *Users // the NAMES reply being collected, until it ends
+
+	modes   map[byte]string      // the B, C and D modes set, with their params
+	lists   map[byte][]ListEntry // the A (list) modes, e.g. bans
+	pending map[byte][]ListEntry // the list replies being collected, until they end
+
+	refresh func(room string) error
 
 	sync.RWMutex
 }
 
 // NewChannel creates a new Channel named 'name'
 func NewChannel(name string) *Channel {
+	return newChannel(name, nil, nil)
+}
+
+// newChannel creates a new Channel whose users are compared as the server does
+func newChannel(name string, server *ServerInfo, refresh func(room string) error) *Channel {
 	return &Channel{
-		Name:  name,
-		users: &Users{m: make(map[string]*User)},
+		Name:    name,
+		users:   &Users{m: make(map[string]*User), server: server},
+		modes:   make(map[byte]string),
+		lists:   make(map[byte][]ListEntry),
+		refresh: refresh,
 	}
 }
 
+// Refresh asks the server about everyone in the channel with WHO,
+// updating their hostmasks, accounts and away status as the replies arrive.
+// It returns ErrClosed if the channel isn't tracked by a connection
+func (c *Channel) Refresh() error {
+	if c.refresh == nil {
+		return ErrClosed
+	}
+	return c.refresh(c.Name)
+}
+
 // Users returns the user collection for the channel
 func (c *Channel) Users() *Users {
 	return c.users
 }
 
+// MemberModes returns the membership modes, e.g. "ov", the user with nick has
+// in the channel, highest rank first
+func (c *Channel) MemberModes(nick string) string {
+	return c.users.Modes(nick)
+}
+
+// IsOp returns whether the user with nick is a channel operator, or ranked above one
+func (c *Channel) IsOp(nick string) bool {
+	return c.users.HasRank(nick, 'o')
+}
+
+// IsHalfOp returns whether the user with nick is a half-operator, or ranked above one
+func (c *Channel) IsHalfOp(nick string) bool {
+	return c.users.HasRank(nick, 'h')
+}
+
+// IsVoiced returns whether the user with nick has voice, or is ranked above it
+func (c *Channel) IsVoiced(nick string) bool {
+	return c.users.HasRank(nick, 'v')
+}
+
+// addNames adds users, and their membership modes, from a NAMES reply to the batch being collected
+func (c *Channel) addNames(users []*User, modes []string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.names == nil {
+		c.names = &Users{m: make(map[string]*User), server: c.users.server}
+	}
+
+	for i, user := range users {
+		// keep what we already know about them, taking the reply's user and host if it has them
+		if known, ok := c.users.Get(user.Nickname); ok {
+			merged := known.Clone()
+			merged.merge(user)
+			user = merged
+		}
+		c.names.Add(user)
+		c.names.setModes(user.Nickname, modes[i])
+	}
+}
+
+// endNames replaces the users with the collected NAMES reply
+func (c *Channel) endNames() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.names == nil {
+		return
+	}
+
+	c.users.replace(c.names)
+	c.names = nil
+}
+
 // Topic sets the channels' topic to 't'
 func (c *Channel) Topic(t string) {
 	c.Lock()
@@ -41,3 +127,125 @@ func (c *Channel) GetTopic() string {
 
 	return c.topic
 }
+
+// TopicSetter returns the nick, or mask, of who set the topic, if we know
+func (c *Channel) TopicSetter() string {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.topicSetter
+}
+
+// TopicTime returns when the topic was set, if we know
+func (c *Channel) TopicTime() time.Time {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.topicTime
+}
+
+// setTopicInfo records who set the topic and when
+func (c *Channel) setTopicInfo(setter string, at time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.topicSetter, c.topicTime = setter, at
+}
+
+// Modes returns the channel's modes, without their params, e.g. "klnt"
+func (c *Channel) Modes() string {
+	c.RLock()
+	defer c.RUnlock()
+
+	out := make([]byte, 0, len(c.modes))
+	for m := range c.modes {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return string(out)
+}
+
+// HasMode returns whether the channel has the mode set, e.g. 'm' when it is moderated
+func (c *Channel) HasMode(mode byte) bool {
+	_, ok := c.Mode(mode)
+	return ok
+}
+
+// Mode returns the param of a mode, e.g. the key for 'k', and whether the mode is set
+func (c *Channel) Mode(mode byte) (param string, ok bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	param, ok = c.modes[mode]
+	return
+}
+
+// Key returns the channel key, or an empty string if there isn't one
+func (c *Channel) Key() string {
+	key, _ := c.Mode('k')
+	return key
+}
+
+// Limit returns the channel's user limit, or 0 if there isn't one
+func (c *Channel) Limit() int {
+	limit, _ := c.Mode('l')
+	n, _ := strconv.Atoi(limit)
+	return n
+}
+
+// applyModes updates the channel's modes, and its users' membership modes, with the changes
+// made by setter at the time
+func (c *Channel) applyModes(server *ServerInfo, setter string, at time.Time, changes []ModeChange) {
+	c.Lock()
+	defer c.Unlock()
+
+	lists := server.ChanModes()[0]
+	prefix, _ := server.Prefix()
+
+	for _, change := range changes {
+		switch {
+		case strings.IndexByte(prefix, change.Mode) >= 0:
+			if change.Param != "" {
+				c.users.setMode(change.Param, change.Mode, change.Add)
+			}
+
+		case strings.IndexByte(lists, change.Mode) >= 0:
+			if change.Param != "" {
+				entry := ListEntry{Mask: change.Param, Setter: setter, Time: at}
+				c.lists[change.Mode] = updateList(server, c.lists[change.Mode], entry, change.Add)
+			}
+
+		case change.Add:
+			c.modes[change.Mode] = change.Param
+
+		default:
+			delete(c.modes, change.Mode)
+		}
+	}
+}
+
+// resetModes replaces the channel's modes, but not its lists, with the changes
+func (c *Channel) resetModes(server *ServerInfo, changes []ModeChange) {
+	c.Lock()
+	c.modes = make(map[byte]string)
+	c.Unlock()
+
+	c.applyModes(server, "", time.Time{}, changes)
+}
+
+// updateList adds or removes the entry's mask from the list
+func updateList(server *ServerInfo, list []ListEntry, entry ListEntry, add bool) []ListEntry {
+	for i, e := range list {
+		if server.EqualFold(e.Mask, entry.Mask) {
+			if add {
+				return list
+			}
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+
+	if add {
+		list = append(list, entry)
+	}
+	return list
+}
@@ -4,17 +4,27 @@ import "sync"
 
 // Channels represents a collection of channels
 type Channels struct {
-	m map[string]*Channel
+	m      map[string]*Channel
+	server *ServerInfo // for the casemapping, the defaults if nil
+
+	refresh func(room string) error // sends a WHO for the channel
+
 	sync.RWMutex
 }
 
+// newChannels returns an empty collection, comparing names as the server does
+// and refreshing channels with refresh
+func newChannels(server *ServerInfo, refresh func(room string) error) *Channels {
+	return &Channels{m: make(map[string]*Channel), server: server, refresh: refresh}
+}
+
 // Add adds a new channel, with the name 'name' to the collection
 func (c *Channels) Add(name string) {
 	c.Lock()
 	defer c.Unlock()
 
 	log.Debugf("adding channel '%s'", name)
-	c.m[name] = NewChannel(name) // TODO cache this
+	c.m[c.key(name)] = newChannel(name, c.server, c.refresh) // TODO cache this
 }
 
 // Remove removes channel, with the name 'name' from the collection
@@ -23,7 +33,7 @@ func (c *Channels) Remove(name string) {
 	defer c.Unlock()
 
 	log.Debugf("remove channel '%s'", name)
-	delete(c.m, name)
+	delete(c.m, c.key(name))
 }
 
 // Has returns whether the collection has a channel named 'name'
@@ -32,12 +42,13 @@ func (c *Channels) Has(name string) (ok bool) {
 	return
 }
 
-// Get returns a channel, named 'name' and if it exists
+// Get returns a channel, named 'name' and if it exists.
+// The name is compared using the server's casemapping
 func (c *Channels) Get(name string) (ch *Channel, ok bool) {
 	c.RLock()
 	defer c.RUnlock()
 
-	ch, ok = c.m[name]
+	ch, ok = c.m[c.key(name)]
 	return
 }
 
@@ -47,16 +58,28 @@ func (c *Channels) GetNames() []string {
 	defer c.RUnlock()
 
 	out := make([]string, 0, len(c.m))
-	for k := range c.m {
-		out = append(out, k)
+	for _, ch := range c.m {
+		out = append(out, ch.Name)
 	}
 	return out
 }
 
 func (c *Channels) forEach(user *User, fn func(ch *Channel)) {
 	for _, name := range c.GetNames() {
-		if ch, _ := c.Get(name); ch.Users().Has(user) {
+		if ch, ok := c.Get(name); ok && ch.Users().Has(user) {
 			fn(ch)
 		}
 	}
 }
+
+// clear removes every channel from the collection
+func (c *Channels) clear() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.m = make(map[string]*Channel)
+}
+
+func (c *Channels) key(name string) string {
+	return serverInfo(c.server).Fold(name)
+}
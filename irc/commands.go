@@ -5,9 +5,14 @@ type Commands interface {
 	Join(room string)
 	Part(room string)
 	Kick(room, user, msg string)
+	Ban(room, mask string)
+	Unban(room, mask string)
+	KickBan(room, user, msg string)
 	Nick(nick string)
 	Quit(msg string)
+	Topic(room, topic string) error
 
+	Send(msg *Message) error
 	Raw(f string, args ...interface{})
 	Privmsg(t, f string, args ...interface{})
 	Notice(t, f string, args ...interface{})
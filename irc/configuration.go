@@ -1,5 +1,11 @@
 package irc
 
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
 // Configuration holds the info required to connect
 type Configuration struct {
 	Hostname string
@@ -8,6 +14,67 @@ type Configuration struct {
 
 	Nickname, Username, Realname string
 
+	// AltNicknames are tried in order when the Nickname is taken while registering,
+	// after them NickGenerator makes up nicks from it. NickGenerator also replaces nicks
+	// given to Commands.Nick that are taken. A nil NickGenerator gives up instead
+	AltNicknames  []string
+	NickGenerator NickGenerator
+
+	// RegainNick takes the Nickname back when it frees up, watching for it with MONITOR
+	// if the server supports it, otherwise with an ISON every RegainInterval
+	RegainNick     bool
+	RegainInterval time.Duration
+
+	// Capabilities are the IRCv3 capabilities requested, if the server offers them
+	Capabilities []string
+
+	// TLS connects to the server over TLS
+	TLS bool
+	// TLSServerName overrides the name the server's certificate is verified against,
+	// it defaults to the Hostname
+	TLSServerName string
+	// TLSRootCAs is the pool the server's certificate is verified against,
+	// it defaults to the system pool
+	TLSRootCAs *x509.CertPool
+	// TLSInsecureSkipVerify skips verifying the server's certificate, for testing only
+	TLSInsecureSkipVerify bool
+	// TLSCertificate, or the pair TLSCertFile and TLSKeyFile, is sent to the server
+	// as a client certificate, for CertFP authentication
+	TLSCertificate          *tls.Certificate
+	TLSCertFile, TLSKeyFile string
+
+	// SASLMechanism authenticates with SASL during registration, either "PLAIN",
+	// using SASLUsername and SASLPassword, or "EXTERNAL", using the TLS client certificate
+	SASLMechanism              string
+	SASLUsername, SASLPassword string
+	// SASLRequired closes the connection if SASL authentication fails
+	SASLRequired bool
+
+	// FloodBurst lines can be sent at once, after that one line is sent every
+	// FloodInterval. A zero FloodInterval turns off flood control
+	FloodBurst    int
+	FloodInterval time.Duration
+
+	// Workers is how many goroutines run the event handlers added with Events.Add.
+	// The default events, which keep track of the channels, always run in order on their own.
+	// With more than one worker, handlers for different messages can run at the same time.
+	// The messages wait for a free worker without limit, so handlers mustn't block for long,
+	// e.g. waiting on a reply from the server, or the messages after them pile up
+	Workers int
+
+	// AutoWho sends a WHO for each channel we join, so its users' hostmasks and accounts
+	// are known. They are sent at least WhoInterval apart
+	AutoWho     bool
+	WhoInterval time.Duration
+
+	// PingInterval is how often the server is pinged, to measure the lag.
+	// If nothing is read from the server for PingTimeout, which is checked at
+	// every ping, the connection is dropped. A zero PingInterval turns off the pings
+	PingInterval, PingTimeout time.Duration
+
+	// Reconnect, if set, redials the server when the connection drops
+	Reconnect *ReconnectPolicy
+
 	Verbose bool
 }
 
@@ -18,6 +85,25 @@ func NewConfiguration() *Configuration {
 		Port:     6667,
 		Nickname: "anolis",
 		Verbose:  false,
+
+		NickGenerator:  AppendNick,
+		RegainInterval: time.Minute,
+
+		Capabilities: []string{
+			"message-tags", "server-time", "account-tag",
+			"multi-prefix", "userhost-in-names", "extended-join",
+		},
+
+		FloodBurst:    5,
+		FloodInterval: 2 * time.Second,
+
+		Workers: 4,
+
+		AutoWho:     true,
+		WhoInterval: 2 * time.Second,
+
+		PingInterval: 30 * time.Second,
+		PingTimeout:  2 * time.Minute,
 	}
 
 	c.Username = c.Nickname
@@ -25,3 +111,28 @@ func NewConfiguration() *Configuration {
 
 	return c
 }
+
+// tlsConfig returns the tls.Config described by the TLS options
+func (c *Configuration) tlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{
+		ServerName:         c.TLSServerName,
+		RootCAs:            c.TLSRootCAs,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+	if conf.ServerName == "" {
+		conf.ServerName = c.Hostname
+	}
+
+	switch {
+	case c.TLSCertificate != nil:
+		conf.Certificates = []tls.Certificate{*c.TLSCertificate}
+	case c.TLSCertFile != "" || c.TLSKeyFile != "":
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
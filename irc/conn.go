@@ -1,9 +1,18 @@
 package irc
 
+import (
+	"context"
+	"time"
+)
+
 // Conn is an abstract connection
 type Conn interface {
 	Close()
+	Shutdown(ctx context.Context, reason string) error
 	WaitForClose() <-chan struct{}
+	Err() error
 	CurrentNick() string
 	UpdateNick(string)
+	QueueLen() int
+	Lag() time.Duration
 }
@@ -1,123 +1,383 @@
 package irc
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/textproto"
+	"strings"
 	"sync"
 )
 
 // Connection represents a connection to an irc server
 type Connection struct {
+	conf     *Configuration
 	address  string
 	nickname string
 
-	ev *Events
-	ch *Channels
+	// our user and host, as the server relays our messages
+	username, hostname string
 
-	conn *textproto.Conn
-	once sync.Once
-	done chan struct{}
+	ev     *Events
+	proto  *Events // the connection's own handlers, run before ev
+	ch     *Channels
+	caps   *Capabilities
+	server *ServerInfo
 
-	sync.RWMutex // TODO use this to make us thread-safe
+	conn     *textproto.Conn
+	queue    *sendQueue
+	whoLimit *whoLimiter
+	alive    *keepalive
+	nicks    *nickPicker
+	jobs     *jobQueue // messages waiting for the worker pool
+	once     sync.Once
+	done     chan struct{}
+
+	// ctx is cancelled when the connection closes. session is handed to the events,
+	// it's cancelled when the link drops too, and replaced once we reconnect
+	ctx        context.Context
+	cancel     context.CancelFunc
+	session    context.Context
+	endSession context.CancelFunc
+
+	registered bool
+	connected  bool       // whether the link is up, it's down while we wait to reconnect
+	quitting   bool       // whether we sent QUIT, so the server closing the link is expected
+	authed     bool       // whether SASL authentication succeeded
+	reason     error      // why the server is hanging up, if it told us
+	err        error      // why the connection closed
+	attempts   int        // reconnect attempts since we were last registered
+	rejoin     []*Message // the JOINs for our channels, to send once we have reconnected
+
+	sync.RWMutex
 }
 
+// logOnce guards the package logger, the first Dial sets its verbosity
+var logOnce sync.Once
+
 // Dial connects to the address with the nickname
-// and returns a Conn
-func Dial(conf *Configuration) Context {
-	initLogger(conf.Verbose)
-	conn := &Connection{
-		address:  fmt.Sprintf("%s:%d", conf.Hostname, conf.Port),
-		nickname: conf.Nickname,
+// and returns a Conn. The error, if any, will be a *ConnectError.
+// It returns before registering, Err reports if the server refuses us
+func Dial(conf *Configuration) (Context, error) {
+	conn, _, err := open(context.Background(), conf)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
 
-		ch: &Channels{m: make(map[string]*Channel)},
-		ev: NewEvents(),
+// DialContext is like Dial, but it waits until the server has welcomed us.
+// If the server refuses us, or ctx is done first, the connection is closed and
+// the *RegistrationError, or a *ConnectError with ctx's error, is returned.
+// Once it returns ctx no longer matters. Events added after it returns won't see the welcome
+func DialContext(ctx context.Context, conf *Configuration) (Context, error) {
+	conn, welcomed, err := open(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
 
-		done: make(chan struct{}),
+	select {
+	case <-welcomed:
+	case <-conn.done:
+	case <-ctx.Done():
+		conn.closeWith(&ConnectError{conn.address, ctx.Err()})
 	}
 
-	log.Debugf("connecting to %s", conn.address)
-	tp, err := textproto.Dial("tcp", conn.address)
-	if err != nil {
-		log.Fatalf(err.Error())
+	// the connection can close as we're welcomed, e.g. when SASL is required
+	if conn.isClosed() {
+		return nil, conn.Err()
 	}
+	return conn, nil
+}
 
-	conn.conn = tp
-	if conf.Password != "" {
-		conn.Raw("PASS %s", conf.Password)
+// open connects to the server and starts the connection's goroutines,
+// welcomed is closed once the server welcomes us
+func open(ctx context.Context, conf *Configuration) (conn *Connection, welcomed <-chan struct{}, err error) {
+	logOnce.Do(func() { initLogger(conf.Verbose) })
+	conn = &Connection{
+		conf:    conf,
+		address: fmt.Sprintf("%s:%d", conf.Hostname, conf.Port),
+
+		ev:     NewEvents(),
+		caps:   newCapabilities(),
+		server: NewServerInfo(),
+
+		queue:    newSendQueue(conf.FloodBurst, conf.FloodInterval),
+		whoLimit: &whoLimiter{interval: conf.WhoInterval},
+		alive:    &keepalive{interval: conf.PingInterval, timeout: conf.PingTimeout},
+		nicks:    &nickPicker{gen: conf.NickGenerator},
+		jobs:     newJobQueue(),
+		done:     make(chan struct{}),
 	}
+	conn.ch = newChannels(conn.server, conn.who)
+	conn.proto = conn.protocolEvents()
+	conn.ctx, conn.cancel = context.WithCancel(context.Background())
+	conn.session, conn.endSession = context.WithCancel(conn.ctx)
 
-	conn.Raw("NICK %s", conf.Nickname)
-	conn.Raw("USER %s 0 * :%s", conf.Username, conf.Realname)
+	welcome := make(chan struct{})
+	conn.proto.Once("001", func(msg *Message, ctx Context) { close(welcome) })
+
+	if err := conn.connect(ctx); err != nil {
+		conn.cancel()
+		return nil, nil, err
+	}
+
+	workers := conf.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go conn.worker()
+	}
+	if conf.PingInterval > 0 {
+		go conn.keepaliveLoop()
+	}
+	if conf.RegainNick && conf.RegainInterval > 0 {
+		go conn.regainLoop()
+	}
 
 	log.Debugf("starting readLoop")
 	go conn.readLoop()
-	return conn
+	go conn.writeLoop()
+	return conn, welcome, nil
+}
+
+// connect dials the server and registers with it
+func (c *Connection) connect(ctx context.Context) error {
+	log.Debugf("connecting to %s", c.address)
+	nc, err := c.dial(ctx)
+	if err != nil {
+		return &ConnectError{c.address, err}
+	}
+
+	tp := textproto.NewConn(nc)
+
+	c.Lock()
+	if c.isClosed() {
+		c.Unlock()
+		tp.Close()
+		return ErrClosed
+	}
+
+	c.conn, c.nickname = tp, c.conf.Nickname
+	c.username, c.hostname = "", ""
+	c.server.reset()
+	c.alive.reset()
+	c.registered, c.authed, c.reason = false, false, nil
+	c.connected = true
+	c.Unlock()
+
+	c.register()
+	return nil
+}
+
+// dial opens the network connection to the server
+func (c *Connection) dial(ctx context.Context) (net.Conn, error) {
+	if !c.conf.TLS {
+		return (&net.Dialer{}).DialContext(ctx, "tcp", c.address)
+	}
+
+	conf, err := c.conf.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("starting tls with %s", conf.ServerName)
+	return (&tls.Dialer{Config: conf}).DialContext(ctx, "tcp", c.address)
 }
 
 // Close closes the connection
 func (c *Connection) Close() {
+	c.closeWith(ErrClosed)
+}
+
+// Err returns why the connection closed, or nil if it is still open
+func (c *Connection) Err() error {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.err
+}
+
+func (c *Connection) closeWith(err error) {
 	c.once.Do(func() {
-		log.Debugf("closing connection")
-		c.conn.Close()
+		log.Debugf("closing connection: %s", err)
+		c.Lock()
+		c.err = err
 		close(c.done)
+		conn := c.conn
+		c.Unlock()
+
+		c.cancel()
+		conn.Close()
 	})
 }
 
-// WaitForClose returns a channel that'll be closed when the connection closes
+func (c *Connection) isRegistered() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.registered
+}
+
+func (c *Connection) isConnected() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.connected
+}
+
+func (c *Connection) isQuitting() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.quitting
+}
+
+func (c *Connection) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitForClose returns a channel that'll be closed when the connection closes,
+// Err reports why it closed
 func (c *Connection) WaitForClose() <-chan struct{} {
 	return c.done
 }
 
 // CurrentNick returns the local users' nickname
 func (c *Connection) CurrentNick() string {
+	c.RLock()
+	defer c.RUnlock()
+
 	return c.nickname
 }
 
 // UpdateNick updates the connections nickname
 func (c *Connection) UpdateNick(s string) {
+	c.Lock()
+	defer c.Unlock()
+
 	log.Debugf("updating nickname to: %s", s)
 	c.nickname = s
 }
 
 // Join sends the join command for room
 func (c *Connection) Join(room string) {
-	c.Raw("JOIN %s", room)
+	c.send(NewMessage("JOIN", room))
 }
 
 // Part sends the part command for room
 func (c *Connection) Part(room string) {
-	c.Raw("PART %s", room)
+	c.send(NewMessage("PART", room))
 }
 
 // Kick sends the kick command for user on room with msg
 func (c *Connection) Kick(room, user, msg string) {
-	c.Raw("KICK %s %s :%s", room, user, msg)
+	c.send(NewMessage("KICK", room, user, msg))
 }
 
-// Nick sends the nick command with the new nick
+// Nick sends the nick command with the new nick,
+// if it's taken the Configuration's NickGenerator picks another
 func (c *Connection) Nick(nick string) {
-	c.Raw("NICK %s", nick)
+	c.nicks.want(nick, nil)
+	c.send(NewMessage("NICK", nick))
 }
 
-// Quit sends the quit command with msg
+// Quit sends the quit command with msg, the connection won't
+// reconnect when the server closes it, and will close with ErrQuit
 func (c *Connection) Quit(msg string) {
-	c.Raw("QUIT :%s", msg)
+	c.Lock()
+	c.quitting = true
+	c.Unlock()
+
+	c.send(NewMessage("QUIT", msg))
+}
+
+// Topic sets the topic for room, it returns a *MessageError
+// without sending it if the topic is longer than the server's TOPICLEN
+func (c *Connection) Topic(room, topic string) error {
+	if max := c.server.TopicLen(); max > 0 && len(topic) > max {
+		return &MessageError{"TOPIC", fmt.Sprintf("topic is longer than TOPICLEN (%d)", max)}
+	}
+	return c.Send(NewMessage("TOPIC", room, topic))
 }
 
-// Privmsg sends a private message, f, formatted with args to t
+// Privmsg sends a private message, f, formatted with args to t,
+// split over as many lines as it needs
 func (c *Connection) Privmsg(t, f string, args ...interface{}) {
-	c.Raw("PRIVMSG %s :%s", fmt.Sprintf(f, args...))
+	c.sendText("PRIVMSG", t, fmt.Sprintf(f, args...))
 }
 
-// Notice sends a notice message, f, formatted with args to t
+// Notice sends a notice message, f, formatted with args to t,
+// split over as many lines as it needs
 func (c *Connection) Notice(t, f string, args ...interface{}) {
-	c.Raw("NOTICE %s :%s", fmt.Sprintf(f, args...))
+	c.sendText("NOTICE", t, fmt.Sprintf(f, args...))
+}
+
+// Send validates and sends the message
+func (c *Connection) Send(msg *Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	line := string(msg.Bytes())
+	log.Debugf(">> %s", line)
+	c.write(line)
+	return nil
+}
+
+// send sends the message, logging it if it's invalid
+func (c *Connection) send(msg *Message) {
+	if err := c.Send(msg); err != nil {
+		log.Warnf("%s", err)
+	}
 }
 
 // Raw sends a raw message, f, formatted with args
 func (c *Connection) Raw(f string, args ...interface{}) {
 	log.Debugf(">> "+f, args...)
-	c.conn.Cmd(f, args...)
+	c.write(fmt.Sprintf(f, args...))
+}
+
+// rawSecret sends a raw message like Raw, but keeps its arguments out of the log
+func (c *Connection) rawSecret(f string, args ...interface{}) {
+	log.Debugf(">> %s ****", strings.Fields(f)[0])
+	c.write(fmt.Sprintf(f, args...))
+}
+
+// write queues a line for the server, registration skips the flood control
+func (c *Connection) write(line string) {
+	c.queue.push(line, urgentLine(line) || !c.isRegistered())
+}
+
+// writeLoop writes the queued lines to the server until the connection closes
+func (c *Connection) writeLoop() {
+	for {
+		line, ok := c.queue.next(c.done)
+		if !ok {
+			return
+		}
+
+		c.RLock()
+		conn := c.conn
+		c.RUnlock()
+
+		c.sentIson(line)
+		if err := conn.PrintfLine("%s", line); err != nil {
+			log.Warnf("writing to server: %s", err)
+		}
+	}
+}
+
+// QueueLen returns how many lines are waiting to be sent
+func (c *Connection) QueueLen() int {
+	return c.queue.Len()
 }
 
 // Connection returns the Connection's context (this pointer)
@@ -140,17 +400,81 @@ func (c *Connection) Events() *Events {
 	return c.ev
 }
 
+// Caps returns the Connection's capabilities
+func (c *Connection) Caps() *Capabilities {
+	return c.caps
+}
+
+// Context returns a context.Context that's cancelled when the connection closes,
+// or when it drops and is going to reconnect. Each reconnect starts a new one
+func (c *Connection) Context() context.Context {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.session
+}
+
+// Server returns what the server told us about itself
+func (c *Connection) Server() *ServerInfo {
+	return c.server
+}
+
+// readLoop reads from the server until the connection closes,
+// redialing it when the Configuration has a reconnect policy
 func (c *Connection) readLoop() {
 	for {
-		line, err := c.conn.ReadLine()
+		err := c.readError(c.read())
+		c.Lock()
+		c.connected = false
+		c.Unlock()
+
+		if c.isClosed() {
+			return
+		}
+
+		if c.isQuitting() {
+			c.closeWith(ErrQuit)
+			return
+		}
+
+		if err = c.reconnect(err); err != nil {
+			c.closeWith(err)
+			return
+		}
+	}
+}
+
+// read dispatches lines from the server until reading fails
+func (c *Connection) read() error {
+	c.RLock()
+	conn := c.conn
+	c.RUnlock()
+
+	for {
+		line, err := conn.ReadLine()
 		if err != nil {
-			c.Close()
-			log.Fatalf(err.Error())
-			break
+			return err
+		}
+		c.alive.received()
+
+		msg, err := ParseMessage(line)
+		if err != nil {
+			log.Warnf("%s", err)
+			continue
 		}
 
-		msg := ParseMessage(line)
 		log.Debugf("<< %s", msg)
-		go c.ev.Dispatch(msg, c)
+		c.dispatch(msg)
+	}
+}
+
+// readError returns the close reason for a failed read
+func (c *Connection) readError(err error) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.reason != nil {
+		return c.reason
 	}
+	return &ReadError{err}
 }
@@ -1,9 +1,21 @@
 package irc
 
 import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
+	"math/big"
+	"net"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -13,34 +25,60 @@ type MockConn struct {
 	msg *Message
 	ev  *Events
 
+	caps   *Capabilities
+	server *ServerInfo
+
 	local, user *User
 }
 
 func NewMockConn() *MockConn {
-	log = &NoopLogger{}
+	// Dial'd connections from earlier tests may still be logging
+	logOnce.Do(func() { log = &NoopLogger{} })
+	server := NewServerInfo()
 	return &MockConn{
-		ch:    &Channels{m: make(map[string]*Channel)},
+		ch:    newChannels(server, nil),
 		local: NewUser("anolis!bot@i.am.a.bot"),
 		user:  NewUser("foo!bar@irc.localhost"),
 		ev:    NewEvents(),
+		caps:  newCapabilities(),
+
+		server: server,
 	}
 }
 
 // No-op
 func (m *MockConn) Close() {}
 
+// No-op
+func (m *MockConn) Shutdown(ctx context.Context, reason string) error { return nil }
+
 // No-op
 func (m *MockConn) WaitForClose() <-chan struct{} { return nil }
 
+// No-op
+func (m *MockConn) Err() error { return nil }
+
+// No-op
+func (m *MockConn) QueueLen() int { return 0 }
+
+// No-op
+func (m *MockConn) Lag() time.Duration { return 0 }
+
 func (m *MockConn) CurrentNick() string { return m.local.Nickname }
 func (m *MockConn) UpdateNick(s string) { m.local.Nickname = s }
 
-func (m *MockConn) Join(room string)    { m.ev.Dispatch(m.msg, m) }
-func (m *MockConn) Part(room string)    { m.ev.Dispatch(m.msg, m) }
-func (m *MockConn) Kick(r, u, a string) { m.ev.Dispatch(m.msg, m) }
-func (m *MockConn) Nick(nick string)    { m.ev.Dispatch(m.msg, m) }
-func (m *MockConn) Quit(msg string)     { m.ev.Dispatch(m.msg, m) }
+func (m *MockConn) Join(room string)       { m.ev.Dispatch(m.msg, m) }
+func (m *MockConn) Part(room string)       { m.ev.Dispatch(m.msg, m) }
+func (m *MockConn) Kick(r, u, a string)    { m.ev.Dispatch(m.msg, m) }
+func (m *MockConn) Ban(r, mask string)     { m.ev.Dispatch(m.msg, m) }
+func (m *MockConn) Unban(r, mask string)   { m.ev.Dispatch(m.msg, m) }
+func (m *MockConn) KickBan(r, u, a string) { m.ev.Dispatch(m.msg, m) }
+func (m *MockConn) Nick(nick string)       { m.ev.Dispatch(m.msg, m) }
+func (m *MockConn) Quit(msg string)        { m.ev.Dispatch(m.msg, m) }
 
+func (m *MockConn) Topic(r, t string) error { m.ev.Dispatch(m.msg, m); return nil }
+
+func (m *MockConn) Send(msg *Message) error                  { m.ev.Dispatch(m.msg, m); return nil }
 func (m *MockConn) Raw(f string, args ...interface{})        { m.ev.Dispatch(m.msg, m) }
 func (m *MockConn) Privmsg(t, f string, args ...interface{}) { m.ev.Dispatch(m.msg, m) }
 func (m *MockConn) Notice(t, f string, args ...interface{})  { m.ev.Dispatch(m.msg, m) }
@@ -49,9 +87,13 @@ func (m *MockConn) Channels() *Channels { return m.ch }
 func (m *MockConn) Connection() Conn    { return m }
 func (m *MockConn) Commands() Commands  { return m }
 func (m *MockConn) Events() *Events     { return m.ev }
+func (m *MockConn) Caps() *Capabilities { return m.caps }
+func (m *MockConn) Server() *ServerInfo { return m.server }
+
+func (m *MockConn) Context() context.Context { return context.Background() }
 
 func (m *MockConn) Do(fn func(), u *User, ev string, args ...string) {
-	m.msg = ParseMessage(fmt.Sprintf(
+	m.msg, _ = ParseMessage(fmt.Sprintf(
 		":%s!%s@%s %s %s",
 		u.Nickname, u.Username, u.Hostname,
 		ev, strings.Join(args, " "),
@@ -60,6 +102,18 @@ func (m *MockConn) Do(fn func(), u *User, ev string, args ...string) {
 	fn()
 }
 
+// dispatch dispatches a raw line from the server
+func (m *MockConn) dispatch(line string) {
+	m.msg, _ = ParseMessage(line)
+	m.ev.Dispatch(m.msg, m)
+}
+
+// names dispatches a complete NAMES reply for the channel
+func (m *MockConn) names(room, names string) {
+	m.dispatch(fmt.Sprintf(":irc.localhost 353 %s = %s :%s", m.local.Nickname, room, names))
+	m.dispatch(fmt.Sprintf(":irc.localhost 366 %s %s :End of /NAMES list.", m.local.Nickname, room))
+}
+
 func TestConnection_LocalUser(t *testing.T) {
 	mock := NewMockConn()
 	Convey("connection should", t, func() {
@@ -130,8 +184,19 @@ func TestConnection_User(t *testing.T) {
 		Convey("when a user changes names", func() {
 			ch, _ := mock.Channels().Get("#hello")
 			mock.Do(func() { mock.Nick("baz") }, mock.user, "NICK", "baz")
-			So(mock.user.Nickname, ShouldEqual, "baz")
-			So(ch.Users().Has(mock.user), ShouldBeTrue)
+			So(ch.Users().HasName("baz"), ShouldBeTrue)
+			So(ch.Users().HasName("foo"), ShouldBeFalse)
+
+			// the message's user is left as it was
+			So(mock.user.Nickname, ShouldEqual, "foo")
+		})
+
+		Convey("when a user's host changes", func() {
+			ch, _ := mock.Channels().Get("#hello")
+			mock.Do(func() { mock.Raw("CHGHOST") }, mock.user, "CHGHOST", "baz", "example.com")
+			user, _ := ch.Users().Get("foo")
+			So(user.Mask(), ShouldEqual, "foo!baz@example.com")
+			So(mock.user.Mask(), ShouldEqual, "foo!bar@irc.localhost")
 		})
 
 		Convey("when the topic changes", func() {
@@ -173,10 +238,550 @@ func TestConnection_Channels(t *testing.T) {
 			c, _ := mock.Channels().Get("#test")
 			b, _ := mock.Channels().Get("#world")
 
-			So(mock.user.Nickname, ShouldEqual, "baz")
-			So(a.Users().Has(mock.user), ShouldBeTrue)
-			So(b.Users().Has(mock.user), ShouldBeTrue)
-			So(c.Users().Has(mock.user), ShouldBeTrue)
+			So(mock.user.Nickname, ShouldEqual, "foo")
+			So(a.Users().HasName("baz"), ShouldBeTrue)
+			So(b.Users().HasName("baz"), ShouldBeTrue)
+			So(c.Users().HasName("baz"), ShouldBeTrue)
+		})
+	})
+}
+
+func TestConnection_CaseMapping(t *testing.T) {
+	mock := NewMockConn()
+	Convey("connection should ignore case", t, func() {
+		mock.Do(func() { mock.Join("#Hello") }, mock.local, "JOIN", "#Hello")
+		mock.Do(func() { mock.Join("#hello") }, mock.user, "JOIN", ":#HELLO")
+
+		Convey("when a user joins", func() {
+			ch, ok := mock.Channels().Get("#hello")
+			So(ok, ShouldBeTrue)
+			So(ch.Name, ShouldEqual, "#Hello")
+			So(ch.Users().HasName("FOO"), ShouldBeTrue)
+		})
+
+		Convey("when a user gets kicked", func() {
+			ch, _ := mock.Channels().Get("#hello")
+			mock.Do(func() { mock.Kick("#hello", "Foo", "bye") },
+				mock.local, "KICK", "#HeLLo", "Foo", ":bye")
+			So(ch.Users().Has(mock.user), ShouldBeFalse)
+		})
+
+		Convey("when we get kicked", func() {
+			mock.Do(func() { mock.Kick("#hello", "ANOLIS", "bye") },
+				mock.user, "KICK", "#hello", "ANOLIS", ":bye")
+			So(mock.Channels().Has("#HELLO"), ShouldBeFalse)
+		})
+
+		Convey("when we part", func() {
+			local := NewUser("Anolis!bot@i.am.a.bot")
+			mock.Do(func() { mock.Part("#hello") }, local, "PART", "#HELLO", ":bye")
+			So(mock.Channels().Has("#hello"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestConnection_Topic(t *testing.T) {
+	mock := NewMockConn()
+	Convey("connection should update the topic", t, func() {
+		mock.Do(func() { mock.Join("#hello") }, mock.local, "JOIN", "#hello")
+		ch, _ := mock.Channels().Get("#hello")
+
+		Convey("when we join", func() {
+			mock.dispatch(":irc.localhost 332 anolis #hello :hello world")
+			mock.dispatch(":irc.localhost 333 anolis #hello foo!bar@baz 1700000000")
+			So(ch.GetTopic(), ShouldEqual, "hello world")
+			So(ch.TopicSetter(), ShouldEqual, "foo!bar@baz")
+			So(ch.TopicTime(), ShouldEqual, time.Unix(1700000000, 0))
+
+			Convey("and clear it when there isn't one", func() {
+				mock.dispatch(":irc.localhost 331 anolis #hello :No topic is set")
+				So(ch.GetTopic(), ShouldEqual, "")
+				So(ch.TopicSetter(), ShouldEqual, "")
+				So(ch.TopicTime().IsZero(), ShouldBeTrue)
+			})
+		})
+
+		Convey("when someone changes it", func() {
+			mock.dispatch("@time=2024-01-02T03:04:05.000Z :foo!bar@baz TOPIC #hello :new topic")
+			So(ch.GetTopic(), ShouldEqual, "new topic")
+			So(ch.TopicSetter(), ShouldEqual, "foo!bar@baz")
+			So(ch.TopicTime(), ShouldEqual, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+			mock.dispatch(":foo!bar@baz TOPIC #hello :")
+			So(ch.GetTopic(), ShouldEqual, "")
+		})
+	})
+}
+
+func TestConnection_Names(t *testing.T) {
+	mock := NewMockConn()
+	Convey("connection should update channel users from names", t, func() {
+		mock.Do(func() { mock.Join("#hello") }, mock.local, "JOIN", "#hello")
+		mock.Do(func() { mock.Join("#hello") }, mock.user, "JOIN", ":#hello")
+		ch, _ := mock.Channels().Get("#hello")
+
+		Convey("across several replies", func() {
+			mock.dispatch(":irc.localhost 353 anolis = #hello :@anolis foo")
+			mock.dispatch(":irc.localhost 353 anolis = #hello :+bar")
+
+			Convey("only once they end", func() {
+				So(ch.Users().HasName("bar"), ShouldBeFalse)
+
+				mock.dispatch(":irc.localhost 366 anolis #hello :End of /NAMES list.")
+				So(ch.Users().HasName("bar"), ShouldBeTrue)
+				So(ch.IsVoiced("bar"), ShouldBeTrue)
+				So(ch.IsOp("anolis"), ShouldBeTrue)
+			})
+
+			Convey("keeping what we know about users", func() {
+				mock.dispatch(":irc.localhost 366 anolis #hello :End of /NAMES list.")
+				user, _ := ch.Users().Get("foo")
+				So(user.Hostname, ShouldEqual, "irc.localhost")
+			})
+		})
+
+		Convey("dropping users who aren't listed", func() {
+			mock.names("#hello", "anolis")
+			So(ch.Users().HasName("anolis"), ShouldBeTrue)
+			So(ch.Users().HasName("foo"), ShouldBeFalse)
+		})
+
+		Convey("with userhost-in-names", func() {
+			mock.names("#hello", "@anolis!bot@i.am.a.bot +baz!qux@example.com")
+			user, ok := ch.Users().Get("baz")
+			So(ok, ShouldBeTrue)
+			So(user.Username, ShouldEqual, "qux")
+			So(user.Hostname, ShouldEqual, "example.com")
+			So(ch.MemberModes("baz"), ShouldEqual, "v")
+		})
+
+		Convey("ignoring channels we aren't in", func() {
+			mock.names("#other", "foo bar")
+			So(mock.Channels().Has("#other"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestConnection_Membership(t *testing.T) {
+	mock := NewMockConn()
+	msg, _ := ParseMessage(":irc.localhost 005 anolis PREFIX=(qaohv)~&@%+ :are supported by this server")
+	mock.server.isupportEvent(msg, mock)
+
+	Convey("connection should track membership", t, func() {
+		mock.Do(func() { mock.Join("#hello") }, mock.local, "JOIN", "#hello")
+		mock.names("#hello", "@%anolis +foo ~bar baz")
+		ch, _ := mock.Channels().Get("#hello")
+
+		Convey("from a names reply", func() {
+			So(ch.Users().HasName("baz"), ShouldBeTrue)
+			So(ch.MemberModes("anolis"), ShouldEqual, "oh")
+			So(ch.MemberModes("foo"), ShouldEqual, "v")
+			So(ch.MemberModes("baz"), ShouldEqual, "")
+
+			So(ch.IsOp("anolis"), ShouldBeTrue)
+			So(ch.IsOp("bar"), ShouldBeTrue)
+			So(ch.IsOp("foo"), ShouldBeFalse)
+			So(ch.IsVoiced("foo"), ShouldBeTrue)
+			So(ch.IsHalfOp("baz"), ShouldBeFalse)
+		})
+
+		Convey("when modes change", func() {
+			mock.Do(func() { mock.Raw("MODE") }, mock.local, "MODE", "#hello", "+o-v+l", "FOO", "foo", "10")
+			So(ch.MemberModes("foo"), ShouldEqual, "o")
+
+			mock.Do(func() { mock.Raw("MODE") }, mock.local, "MODE", "#hello", "-oh+v", "anolis", "anolis", "anolis")
+			So(ch.MemberModes("anolis"), ShouldEqual, "v")
+			So(ch.IsOp("anolis"), ShouldBeFalse)
+		})
+
+		Convey("when a user changes nick", func() {
+			mock.Do(func() { mock.Nick("foo_") }, mock.user, "NICK", "foo_")
+			So(ch.MemberModes("foo"), ShouldEqual, "")
+			So(ch.MemberModes("foo_"), ShouldEqual, "v")
+		})
+
+		Convey("when a user parts", func() {
+			mock.Do(func() { mock.Part("#hello") }, NewUser("bar!bar@irc.localhost"), "PART", "#hello", ":bye")
+			So(ch.MemberModes("bar"), ShouldEqual, "")
+		})
+	})
+}
+
+// testServer is a fake irc server to Dial
+type testServer struct {
+	ln    net.Listener
+	conns chan *testClient
+}
+
+// testClient is the server side of a Dial'd connection
+type testClient struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newTestServer() *testServer {
+	return newTLSTestServer(nil)
+}
+
+// newTLSTestServer starts a testServer that speaks TLS with conf, if it isn't nil
+func newTLSTestServer(conf *tls.Config) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	if conf != nil {
+		ln = tls.NewListener(ln, conf)
+	}
+
+	s := &testServer{ln: ln, conns: make(chan *testClient, 8)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if tc, ok := conn.(*tls.Conn); ok && tc.Handshake() != nil {
+				continue
+			}
+			s.conns <- &testClient{conn, bufio.NewReader(conn)}
+		}
+	}()
+	return s
+}
+
+func (s *testServer) Configuration() *Configuration {
+	conf := NewConfiguration()
+	conf.Hostname = "127.0.0.1"
+	conf.Port = s.ln.Addr().(*net.TCPAddr).Port
+	return conf
+}
+
+func (s *testServer) Accept() *testClient {
+	select {
+	case c := <-s.conns:
+		return c
+	case <-time.After(2 * time.Second):
+		panic("timed out waiting for a connection")
+	}
+}
+
+func (s *testServer) Close() { s.ln.Close() }
+
+// Expect reads lines until one starts with prefix, and returns it
+func (c *testClient) Expect(prefix string) string {
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return ""
+		}
+		if line = strings.TrimRight(line, "\r\n"); strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+}
+
+func (c *testClient) Send(f string, args ...interface{}) {
+	fmt.Fprintf(c, f+"\r\n", args...)
+}
+
+// newTestCert returns a self-signed certificate for name
+func newTestCert(name string) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+// waitForClose waits for ctx to close, and returns its close reason
+func waitForClose(ctx Context) error {
+	select {
+	case <-ctx.Connection().WaitForClose():
+		return ctx.Connection().Err()
+	case <-time.After(2 * time.Second):
+		return errors.New("timed out waiting for close")
+	}
+}
+
+// eventually polls fn until it is true, or gives up after a while
+func eventually(fn func() bool) bool {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		if fn() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestDial(t *testing.T) {
+	Convey("dial should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		Convey("return a ConnectError when it can't connect", func() {
+			conf := srv.Configuration()
+			srv.Close()
+
+			ctx, err := Dial(conf)
+			So(ctx, ShouldBeNil)
+			So(err, ShouldHaveSameTypeAs, &ConnectError{})
+		})
+
+		Convey("register with the server", func() {
+			conf := srv.Configuration()
+			conf.Password = "hunter2"
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			So(client.Expect("PASS"), ShouldEqual, "PASS hunter2")
+			So(client.Expect("NICK"), ShouldEqual, "NICK anolis")
+			So(client.Expect("USER"), ShouldEqual, "USER anolis 0 * :anolis")
+		})
+
+		Convey("send messages", func() {
+			ctx, err := Dial(srv.Configuration())
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			ctx.Commands().Privmsg("#foobar", "100%% done\r\nQUIT :%s", "injected")
+			So(client.Expect("PRIVMSG"), ShouldEqual, "PRIVMSG #foobar :100% doneQUIT :injected")
+
+			So(ctx.Commands().Send(NewMessage("PRIVMSG", "#foo bar", "hello")), ShouldNotBeNil)
+			So(ctx.Commands().Send(NewMessage("NOTICE", "#foobar", "hello")), ShouldBeNil)
+			So(client.Expect("NOTICE"), ShouldEqual, "NOTICE #foobar hello")
+		})
+
+		Convey("set a topic that fits the server's TOPICLEN", func() {
+			ctx, err := Dial(srv.Configuration())
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			So(ctx.Commands().Topic("#foo", "hello world"), ShouldBeNil)
+			So(client.Expect("TOPIC"), ShouldEqual, "TOPIC #foo :hello world")
+
+			client.Send(":irc.localhost 005 anolis TOPICLEN=5 :are supported by this server")
+			So(eventually(func() bool { return ctx.Server().TopicLen() == 5 }), ShouldBeTrue)
+			So(ctx.Commands().Topic("#foo", "hello world"), ShouldResemble,
+				&MessageError{"TOPIC", "topic is longer than TOPICLEN (5)"})
+		})
+
+		Convey("report a ReadError when the server hangs up", func() {
+			ctx, err := Dial(srv.Configuration())
+			So(err, ShouldBeNil)
+
+			srv.Accept().Close()
+			err = waitForClose(ctx)
+			So(err, ShouldHaveSameTypeAs, &ReadError{})
+		})
+
+		Convey("report a RegistrationError when the server refuses us", func() {
+			ctx, err := Dial(srv.Configuration())
+			So(err, ShouldBeNil)
+
+			client := srv.Accept()
+			client.Send(":irc.localhost 464 anolis :Password incorrect")
+			client.Send("ERROR :Closing link: (anolis@localhost) [Bad password]")
+			client.Close()
+
+			err = waitForClose(ctx)
+			So(err, ShouldResemble, &RegistrationError{"464", "Password incorrect"})
+		})
+
+		Convey("report a ServerError when the server closes the link", func() {
+			ctx, err := Dial(srv.Configuration())
+			So(err, ShouldBeNil)
+
+			client := srv.Accept()
+			client.Send(":irc.localhost 001 anolis :Welcome")
+			client.Send("ERROR :Closing link: (anolis@localhost) [Killed]")
+			client.Close()
+
+			err = waitForClose(ctx)
+			So(err, ShouldResemble, &ServerError{"Closing link: (anolis@localhost) [Killed]"})
+		})
+
+		Convey("report ErrClosed when we close it", func() {
+			ctx, err := Dial(srv.Configuration())
+			So(err, ShouldBeNil)
+
+			srv.Accept()
+			ctx.Connection().Close()
+			So(waitForClose(ctx), ShouldEqual, ErrClosed)
+		})
+	})
+}
+
+func TestDialContext(t *testing.T) {
+	Convey("dial with a context should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		// welcome answers the next connection with welcome, and hands over its client
+		welcome := func(lines ...string) <-chan *testClient {
+			clients := make(chan *testClient, 1)
+			go func() {
+				client := srv.Accept()
+				for _, line := range lines {
+					client.Send(line)
+				}
+				clients <- client
+			}()
+			return clients
+		}
+
+		Convey("not connect when the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			conn, err := DialContext(ctx, srv.Configuration())
+			So(conn, ShouldBeNil)
+			So(err, ShouldHaveSameTypeAs, &ConnectError{})
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		})
+
+		Convey("return a ConnectError when the server doesn't welcome us in time", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			conn, err := DialContext(ctx, srv.Configuration())
+			So(conn, ShouldBeNil)
+			So(err, ShouldHaveSameTypeAs, &ConnectError{})
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		})
+
+		Convey("return a RegistrationError when the server refuses us", func() {
+			clients := welcome(
+				":irc.localhost 464 anolis :Password incorrect",
+				"ERROR :Closing link: (anolis@localhost) [Bad password]",
+			)
+			go func() { (<-clients).Close() }()
+
+			conn, err := DialContext(context.Background(), srv.Configuration())
+			So(conn, ShouldBeNil)
+			So(err, ShouldResemble, &RegistrationError{"464", "Password incorrect"})
+		})
+
+		Convey("wait for the welcome, and then ignore the context", func() {
+			welcome(":irc.localhost 001 anolis :Welcome")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			conn, err := DialContext(ctx, srv.Configuration())
+			So(err, ShouldBeNil)
+			defer conn.Connection().Close()
+			So(conn.Connection().(*Connection).isRegistered(), ShouldBeTrue)
+
+			cancel()
+			time.Sleep(10 * time.Millisecond)
+			So(conn.Connection().Err(), ShouldBeNil)
+		})
+
+		Convey("give events a context that's cancelled when it closes", func() {
+			clients := welcome(":irc.localhost 001 anolis :Welcome")
+			conn, err := DialContext(context.Background(), srv.Configuration())
+			So(err, ShouldBeNil)
+
+			got := make(chan context.Context, 1)
+			conn.Events().Add("PING", func(msg *Message, ctx Context) { got <- ctx.Context() })
+			(<-clients).Send("PING :irc.localhost")
+
+			var ctx context.Context
+			So(eventually(func() bool {
+				select {
+				case ctx = <-got:
+					return true
+				default:
+					return false
+				}
+			}), ShouldBeTrue)
+			So(ctx.Err(), ShouldBeNil)
+
+			conn.Connection().Close()
+			So(ctx.Err(), ShouldEqual, context.Canceled)
+		})
+	})
+}
+
+func TestDialTLS(t *testing.T) {
+	serverCert, serverX509 := newTestCert("irc.localhost")
+	clientCert, clientX509 := newTestCert("anolis")
+
+	Convey("dial with tls should", t, func() {
+		srv := newTLSTestServer(&tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequestClientCert,
+		})
+		defer srv.Close()
+
+		pool := x509.NewCertPool()
+		pool.AddCert(serverX509)
+
+		conf := srv.Configuration()
+		conf.TLS = true
+		conf.TLSServerName = "irc.localhost"
+		conf.TLSRootCAs = pool
+
+		Convey("verify the server and register", func() {
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			So(srv.Accept().Expect("NICK"), ShouldEqual, "NICK anolis")
+		})
+
+		Convey("send our client certificate", func() {
+			conf.TLSCertificate = &clientCert
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			So(client.Expect("NICK"), ShouldEqual, "NICK anolis")
+
+			certs := client.Conn.(*tls.Conn).ConnectionState().PeerCertificates
+			So(certs, ShouldHaveLength, 1)
+			So(certs[0].Equal(clientX509), ShouldBeTrue)
+		})
+
+		Convey("fail when the server can't be verified", func() {
+			conf.TLSRootCAs = x509.NewCertPool()
+			_, err := Dial(conf)
+			So(err, ShouldHaveSameTypeAs, &ConnectError{})
+		})
+
+		Convey("skip verifying the server when asked to", func() {
+			conf.TLSRootCAs = x509.NewCertPool()
+			conf.TLSInsecureSkipVerify = true
+
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			So(srv.Accept().Expect("NICK"), ShouldEqual, "NICK anolis")
 		})
 	})
 }
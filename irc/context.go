@@ -1,9 +1,17 @@
 package irc
 
+import "context"
+
 // Context is the abstract context
 type Context interface {
+	// Context returns a context.Context that's cancelled when the connection closes,
+	// or drops before reconnecting, for events that start long-running work
+	Context() context.Context
+
 	Channels() *Channels
 	Events() *Events
 	Connection() Conn
 	Commands() Commands
+	Caps() *Capabilities
+	Server() *ServerInfo
 }
@@ -0,0 +1,90 @@
+package irc
+
+import "sync"
+
+// dispatchJob is a message waiting for the worker pool, with the events to run for it
+type dispatchJob struct {
+	msg *Message
+	hs  []*Handle
+}
+
+// jobQueue holds the jobs waiting for the worker pool. It has no limit,
+// so reading from the server never waits on the user's events
+type jobQueue struct {
+	jobs []dispatchJob
+	wake chan struct{}
+
+	sync.Mutex
+}
+
+func newJobQueue() *jobQueue {
+	return &jobQueue{wake: make(chan struct{}, 1)}
+}
+
+// push adds the job to the end of the queue
+func (q *jobQueue) push(job dispatchJob) {
+	q.Lock()
+	q.jobs = append(q.jobs, job)
+	q.Unlock()
+
+	q.signal()
+}
+
+// next blocks until there is a job, or done is closed
+func (q *jobQueue) next(done <-chan struct{}) (dispatchJob, bool) {
+	for {
+		q.Lock()
+		if len(q.jobs) > 0 {
+			job := q.jobs[0]
+			q.jobs[0] = dispatchJob{}
+			q.jobs = q.jobs[1:]
+			more := len(q.jobs) > 0
+			q.Unlock()
+
+			// let another worker pick up the rest
+			if more {
+				q.signal()
+			}
+			return job, true
+		}
+		q.Unlock()
+
+		select {
+		case <-q.wake:
+		case <-done:
+			return dispatchJob{}, false
+		}
+	}
+}
+
+func (q *jobQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch runs the connection's own events and the default events for msg,
+// in the order the lines are read, and then queues the user's events for the worker pool
+func (c *Connection) dispatch(msg *Message) {
+	c.proto.Dispatch(msg, c)
+
+	state, rest := split(c.ev.handles(msg.Command))
+	c.ev.invoke(state, msg, c)
+	if len(rest) == 0 {
+		return
+	}
+
+	c.jobs.push(dispatchJob{msg, rest})
+}
+
+// worker runs the user's events, each message's events run in the order they were added
+func (c *Connection) worker() {
+	for {
+		job, ok := c.jobs.next(c.done)
+		if !ok {
+			return
+		}
+		c.ev.invoke(job.hs, job.msg, c)
+	}
+}
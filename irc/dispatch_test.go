@@ -0,0 +1,140 @@
+package irc
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvents_Panics(t *testing.T) {
+	mock := NewMockConn()
+	Convey("events should recover from a panicking event", t, func() {
+		ev := newEvents()
+		mock.ev = ev
+
+		var got *HandlerError
+		var after bool
+		ev.OnHandlerPanic(func(err *HandlerError, ctx Context) { got = err })
+		ev.Add("PRIVMSG", func(msg *Message, ctx Context) { panic("oops") })
+		ev.Add("PRIVMSG", func(msg *Message, ctx Context) { after = true })
+
+		So(func() { mock.dispatch(":foo PRIVMSG #hello :hi") }, ShouldNotPanic)
+		So(after, ShouldBeTrue)
+		So(got, ShouldNotBeNil)
+		So(got.Command, ShouldEqual, "PRIVMSG")
+		So(got.Panic, ShouldEqual, "oops")
+		So(got.Stack, ShouldNotBeEmpty)
+		So(got.Error(), ShouldEqual, "irc: handler for PRIVMSG panicked: oops")
+
+		Convey("even when reporting it panics", func() {
+			ev.Add(HandlerPanicked, func(msg *Message, ctx Context) { panic("again") })
+			So(func() { mock.dispatch(":foo PRIVMSG #hello :hi") }, ShouldNotPanic)
+		})
+	})
+}
+
+func TestDial_Dispatch(t *testing.T) {
+	Convey("dial should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.AutoWho = false
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+
+		Convey("track state in the order lines are read", func() {
+			done := make(chan struct{})
+			ctx.Events().Add("422", func(msg *Message, ctx Context) { close(done) })
+
+			client.Send(":anolis!anolis@localhost JOIN #foo")
+			for i := 0; i < 50; i++ {
+				client.Send(":user%d!u@h JOIN #foo", i)
+				client.Send(":user%d!u@h NICK nick%d", i, i)
+				if i%2 == 0 {
+					client.Send(":nick%d!u@h PART #foo", i)
+				}
+			}
+			client.Send(":irc.localhost 422 anolis :MOTD File is missing")
+			So(eventually(func() bool {
+				select {
+				case <-done:
+					return true
+				default:
+					return false
+				}
+			}), ShouldBeTrue)
+
+			ch, ok := ctx.Channels().Get("#foo")
+			So(ok, ShouldBeTrue)
+			for i := 0; i < 50; i++ {
+				So(ch.Users().HasName(fmt.Sprintf("user%d", i)), ShouldBeFalse)
+				So(ch.Users().HasName(fmt.Sprintf("nick%d", i)), ShouldEqual, i%2 == 1)
+			}
+		})
+
+		Convey("give events the users as they were when their line arrived", func() {
+			seen := make(chan string, 1)
+			release := make(chan struct{})
+			ctx.Events().OnPrivmsg(func(ev *PrivmsgEvent, ctx Context) {
+				<-release
+				seen <- ev.From.Mask()
+			})
+
+			client.Send(":anolis!anolis@localhost JOIN #foo")
+			client.Send(":foo!bar@baz JOIN #foo")
+			client.Send(":foo!bar@baz PRIVMSG #foo :hi")
+			client.Send(":foo!bar@baz NICK renamed")
+			client.Send(":renamed!bar@baz CHGHOST user host")
+			client.Send(":irc.localhost 352 anolis #foo user host irc.localhost renamed G :0 Foo")
+
+			So(eventually(func() bool {
+				ch, ok := ctx.Channels().Get("#foo")
+				if !ok {
+					return false
+				}
+				user, ok := ch.Users().Get("renamed")
+				return ok && user.Away && user.Mask() == "renamed!user@host"
+			}), ShouldBeTrue)
+
+			close(release)
+			So(<-seen, ShouldEqual, "foo!bar@baz")
+		})
+
+		Convey("answer pings while every worker is busy", func() {
+			release := make(chan struct{})
+			defer close(release)
+
+			started := make(chan struct{}, 100)
+			ctx.Events().Add("PRIVMSG", func(msg *Message, ctx Context) {
+				started <- struct{}{}
+				<-release
+			})
+
+			for i := 0; i < 100; i++ {
+				client.Send(":foo!bar@baz PRIVMSG anolis :%d", i)
+			}
+			<-started
+
+			client.Send("PING :alive")
+			So(client.Expect("PONG"), ShouldEqual, "PONG alive")
+		})
+
+		Convey("keep going when an event panics", func() {
+			panicked := make(chan *HandlerError, 1)
+			ctx.Events().OnHandlerPanic(func(err *HandlerError, ctx Context) { panicked <- err })
+			ctx.Events().Add("PRIVMSG", func(msg *Message, ctx Context) { panic("oops") })
+
+			client.Send(":foo!bar@baz PRIVMSG anolis :hi")
+			So((<-panicked).Command, ShouldEqual, "PRIVMSG")
+
+			client.Send("PING :still here")
+			So(client.Expect("PONG"), ShouldEqual, "PONG :still here")
+		})
+	})
+}
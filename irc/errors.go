@@ -0,0 +1,120 @@
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrClosed is the close reason when the connection was closed locally
+var ErrClosed = errors.New("irc: connection closed")
+
+// ErrQuit is the close reason when we quit, with Quit or Shutdown
+var ErrQuit = errors.New("irc: quit requested")
+
+// ConnectError is returned when the connection to the server can't be established
+type ConnectError struct {
+	Address string
+	Err     error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("irc: connecting to %s: %s", e.Address, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ConnectError) Unwrap() error { return e.Err }
+
+// RegistrationError is the close reason when the server refused our registration
+type RegistrationError struct {
+	Code   string // the numeric or command that rejected us
+	Reason string
+}
+
+func (e *RegistrationError) Error() string {
+	return fmt.Sprintf("irc: registration failed (%s): %s", e.Code, e.Reason)
+}
+
+// ReadError is the close reason when reading from the server fails
+type ReadError struct {
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("irc: reading from server: %s", e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ReadError) Unwrap() error { return e.Err }
+
+// TimeoutError is the close reason when the server sent nothing for the PingTimeout
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("irc: no reply from server in %s", e.Timeout)
+}
+
+// ServerError is the close reason when the server sent an ERROR and hung up
+type ServerError struct {
+	Reason string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("irc: server error: %s", e.Reason)
+}
+
+// ReconnectError is the close reason when the reconnect policy gave up
+type ReconnectError struct {
+	Attempts int
+	Err      error // the last error
+}
+
+func (e *ReconnectError) Error() string {
+	return fmt.Sprintf("irc: gave up reconnecting after %d attempts: %s", e.Attempts, e.Err)
+}
+
+// Unwrap returns the last error
+func (e *ReconnectError) Unwrap() error { return e.Err }
+
+// SASLError is the close reason when SASL authentication failed and was required
+type SASLError struct {
+	Code   string // the numeric or command that failed us
+	Reason string
+}
+
+func (e *SASLError) Error() string {
+	return fmt.Sprintf("irc: sasl authentication failed (%s): %s", e.Code, e.Reason)
+}
+
+// ParseError is returned when a line from the server isn't a valid message
+type ParseError struct {
+	Raw    string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("irc: parsing %q: %s", e.Raw, e.Reason)
+}
+
+// MessageError is returned when a message can't be sent
+type MessageError struct {
+	Command string
+	Reason  string
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("irc: can't send %s: %s", e.Command, e.Reason)
+}
+
+// HandlerError is reported, with a HandlerPanicked event, when an Event panics
+type HandlerError struct {
+	Command string // the command being dispatched
+	Panic   string // what it panicked with
+	Stack   string
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("irc: handler for %s panicked: %s", e.Command, e.Panic)
+}
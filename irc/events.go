@@ -1,8 +1,26 @@
 package irc
 
 import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+)
+
+// Synthetic events, dispatched by the Connection rather than the server
+const (
+	// Disconnected is dispatched when the connection drops and will be redialed,
+	// the Params, and the Message, hold the reason
+	Disconnected = "DISCONNECTED"
+
+	// Reconnected is dispatched once the connection has been redialed
+	Reconnected = "RECONNECTED"
+
+	// HandlerPanicked is dispatched when an Event panics,
+	// the Params hold the command, the panic and the stack, see HandlerError
+	HandlerPanicked = "HANDLER_PANICKED"
 )
 
 // Event represents an IRC event
@@ -11,144 +29,454 @@ type Event func(msg *Message, ctx Context)
 // Events holds a collection of events
 type Events struct {
 	sync.RWMutex
-	m map[string][]Event
+	m    map[string][]*Handle
+	next uint64 // the ID of the next Handle
+}
+
+// Handle is an Event registered with Events, it can be used to remove it
+type Handle struct {
+	id    uint64
+	cmd   string
+	fn    Event
+	ev    *Events
+	state bool // a default event, which tracks state and runs in order
+}
+
+// newEvents returns an Events collection without any events
+func newEvents() *Events {
+	return &Events{m: make(map[string][]*Handle)}
 }
 
-// NewEvents returns a new Events collection
+// NewEvents returns a new Events collection with the default events,
+// which keep track of the channels. Default returns their Handles, to remove them with
 func NewEvents() *Events {
-	ev := &Events{m: make(map[string][]Event)}
+	ev := newEvents()
 
 	// default events
-	ev.Add("PING", PingEvent)
-	ev.Add("JOIN", JoinEvent)
-	ev.Add("PART", PartEvent)
-	ev.Add("QUIT", QuitEvent)
-	ev.Add("KICK", KickEvent)
-	ev.Add("NICK", NickEvent)
-	ev.Add("TOPIC", TopicEvent)
-	ev.Add("ERROR", ErrorEvent)
-	ev.Add("PRIVMSG", PrivmsgEvent)
+	ev.addState("PING", PingEvent)
+	ev.addState("JOIN", joinEvent)
+	ev.addState("PART", partEvent)
+	ev.addState("QUIT", quitEvent)
+	ev.addState("KICK", kickEvent)
+	ev.addState("NICK", nickEvent)
+	ev.addState("CHGHOST", ChghostEvent)
+	ev.addState("TOPIC", topicEvent)
+	ev.addState("331", TopicReplyEvent)
+	ev.addState("332", TopicReplyEvent)
+	ev.addState("333", TopicWhoTimeEvent)
+	ev.addState("MODE", modeEvent)
+	ev.addState("324", ChannelModeIsEvent)
+	ev.addState("367", ListEvent)
+	ev.addState("368", EndOfListEvent)
+	ev.addState("348", ListEvent)
+	ev.addState("349", EndOfListEvent)
+	ev.addState("346", ListEvent)
+	ev.addState("347", EndOfListEvent)
+	ev.addState("353", NamesEvent)
+	ev.addState("366", EndOfNamesEvent)
+	ev.addState("352", WhoEvent)
+	ev.addState("354", WhoxEvent)
+	ev.addState("ERROR", ErrorEvent)
+	ev.addState("PRIVMSG", privmsgEvent)
 
 	return ev
 }
 
-// Add register the Event function with the command
-func (e *Events) Add(cmd string, fn Event) {
+// Add register the Event function with the command,
+// and returns a Handle to remove it with
+func (e *Events) Add(cmd string, fn Event) *Handle {
+	return e.add(cmd, fn, false)
+}
+
+// addState registers a default event, which keeps track of state.
+// On a Connection they are run in the order lines are read, before the other events
+func (e *Events) addState(cmd string, fn Event) *Handle {
+	return e.add(cmd, fn, true)
+}
+
+func (e *Events) add(cmd string, fn Event, state bool) *Handle {
+	h := &Handle{cmd: strings.ToUpper(cmd), fn: fn, ev: e, state: state}
+	e.insert(h)
+	return h
+}
+
+// insert registers h, giving it the next id
+func (e *Events) insert(h *Handle) {
+	e.Lock()
+	defer e.Unlock()
+
+	log.Debugf("adding event: %s", h.cmd)
+
+	e.next++
+	h.id = e.next
+	e.m[h.cmd] = append(e.m[h.cmd], h)
+}
+
+// Once registers the Event function with the command, it is removed
+// before it is invoked so it only sees the first matching message
+func (e *Events) Once(cmd string, fn Event) *Handle {
+	// h is built before it's registered, so a Dispatch running at
+	// the same time can't see it before it's set
+	h := &Handle{cmd: strings.ToUpper(cmd), ev: e}
+	var once sync.Once
+	h.fn = func(msg *Message, ctx Context) {
+		once.Do(func() {
+			h.Remove()
+			fn(msg, ctx)
+		})
+	}
+	e.insert(h)
+	return h
+}
+
+// Clear removes every Event registered with the command, including the default ones
+// and the ones added with Add. Use Default to remove only the default ones
+func (e *Events) Clear(cmd string) {
 	e.Lock()
 	defer e.Unlock()
 
 	c := strings.ToUpper(cmd)
-	log.Debugf("adding event: %s", c)
-	e.m[c] = append(e.m[c], fn)
+	log.Debugf("clearing events: %s", c)
+	delete(e.m, c)
+}
+
+// Default returns the Handles of the default events registered with the command,
+// so they can be removed, and replaced, one at a time
+func (e *Events) Default(cmd string) []*Handle {
+	state, _ := split(e.handles(cmd))
+	return state
 }
 
 // Dispatch finds each Event that matches msg's command and invokes it
-// with the Message and the Conn
+// with the Message and the Conn. Events can be added and removed while it runs,
+// and a panicking Event is reported with HandlerPanicked rather than crashing
 func (e *Events) Dispatch(msg *Message, ctx Context) {
+	e.invoke(e.handles(msg.Command), msg, ctx)
+}
+
+// handles returns the Handles registered for the command
+func (e *Events) handles(cmd string) []*Handle {
 	e.RLock()
 	defer e.RUnlock()
 
-	if evs, ok := e.m[strings.ToUpper(msg.Command)]; ok {
-		for _, ev := range evs {
-			log.Debugf("dispatching to: %s -> %s", msg.Command, msg.String())
-			ev(msg, ctx)
+	return e.m[strings.ToUpper(cmd)]
+}
+
+// split splits the handles into the default ones and the rest
+func split(hs []*Handle) (state, rest []*Handle) {
+	for _, h := range hs {
+		if h.state {
+			state = append(state, h)
+		} else {
+			rest = append(rest, h)
 		}
 	}
+	return
+}
+
+// invoke runs each Event in turn
+func (e *Events) invoke(hs []*Handle, msg *Message, ctx Context) {
+	for _, h := range hs {
+		log.Debugf("dispatching to: %s -> %s", msg.Command, msg.String())
+		e.call(h, msg, ctx)
+	}
+}
+
+// call runs the Event, recovering and reporting it if it panics
+func (e *Events) call(h *Handle, msg *Message, ctx Context) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		err := &HandlerError{Command: msg.Command, Panic: fmt.Sprint(r), Stack: string(debug.Stack())}
+		log.Warnf("%s", err)
+		if msg.Command != HandlerPanicked {
+			e.Dispatch(NewMessage(HandlerPanicked, err.Command, err.Panic, err.Stack), ctx)
+		}
+	}()
+
+	h.fn(msg, ctx)
+}
+
+// ID returns the Handle's ID, unique within its Events
+func (h *Handle) ID() uint64 {
+	return h.id
+}
+
+// Remove removes the Event from its Events,
+// it returns false if it had already been removed
+func (h *Handle) Remove() bool {
+	e := h.ev
+	e.Lock()
+	defer e.Unlock()
+
+	hs := e.m[h.cmd]
+	for i, other := range hs {
+		if other == h {
+			// copy so a Dispatch that's running keeps its own slice
+			e.m[h.cmd] = append(hs[:i:i], hs[i+1:]...)
+			if len(e.m[h.cmd]) == 0 {
+				delete(e.m, h.cmd)
+			}
+			return true
+		}
+	}
+	return false
 }
 
 // Default events
 
-// PingEvent replies to a 'PONG' from the server
+// PingEvent replies to a 'PING' from the server
 func PingEvent(msg *Message, ctx Context) {
-	ctx.Commands().Raw("PONG %s", msg.Message)
+	ctx.Commands().Send(NewMessage("PONG", msg.Params...))
 }
 
-// JoinEvent updates the channel user list when a user joins
-func JoinEvent(msg *Message, ctx Context) {
-	if len(msg.Args) > 0 {
+// joinEvent updates the channel user list when a user joins
+func joinEvent(msg *Message, ctx Context) {
+	ev, ok := decodeJoin(msg)
+	if !ok {
+		return
+	}
+
+	if ctx.Server().EqualFold(ctx.Connection().CurrentNick(), ev.User.Nickname) {
 		// it was us that joined
-		ctx.Channels().Add(msg.Args[0])
-		log.Debugf("creating new channel '%s'", msg.Args[0])
-		ch, _ := ctx.Channels().Get(msg.Args[0])
-		ch.Users().Add(msg.Source)
-		log.Debugf("adding user '%s' to '%s'", msg.Source.Nickname, ch.Name)
-	} else if ch, ok := ctx.Channels().Get(msg.Message); ok {
-		ch.Users().Add(msg.Source)
-		log.Debugf("adding user '%s' to '%s'", msg.Source.Nickname, ch.Name)
+		ctx.Channels().Add(ev.Channel)
+		log.Debugf("creating new channel '%s'", ev.Channel)
+		ch, _ := ctx.Channels().Get(ev.Channel)
+		ch.Users().Add(ev.User)
+		log.Debugf("adding user '%s' to '%s'", ev.User.Nickname, ch.Name)
+	} else if ch, ok := ctx.Channels().Get(ev.Channel); ok {
+		user := ev.User.Clone()
+		user.Account = ev.Account
+		ch.Users().Add(user)
+		log.Debugf("adding user '%s' to '%s'", ev.User.Nickname, ch.Name)
 	}
 }
 
-// PartEvent updates the channel user list when a user leaves
-func PartEvent(msg *Message, ctx Context) {
-	if ctx.Connection().CurrentNick() == msg.Source.Nickname {
+// partEvent updates the channel user list when a user leaves
+func partEvent(msg *Message, ctx Context) {
+	ev, ok := decodePart(msg)
+	if !ok {
+		return
+	}
+
+	if ctx.Server().EqualFold(ctx.Connection().CurrentNick(), ev.User.Nickname) {
 		// it was us that left
-		ctx.Channels().Remove(msg.Args[0])
-		log.Debugf("removing channel '%s'", msg.Args)
-	} else if ch, ok := ctx.Channels().Get(msg.Args[0]); ok {
-		ch.Users().Remove(msg.Source)
-		log.Debugf("removing '%s' from channel '%s'", msg.Source.Nickname, ch.Name)
+		ctx.Channels().Remove(ev.Channel)
+		log.Debugf("removing channel '%s'", ev.Channel)
+	} else if ch, ok := ctx.Channels().Get(ev.Channel); ok {
+		ch.Users().Remove(ev.User)
+		log.Debugf("removing '%s' from channel '%s'", ev.User.Nickname, ch.Name)
 	}
 }
 
-// KickEvent updates the channel user list when a kick happens
-func KickEvent(msg *Message, ctx Context) {
-	kickee, room := lastString(msg.Args), msg.Args[0]
-	if ctx.Connection().CurrentNick() == kickee {
+// kickEvent updates the channel user list when a kick happens
+func kickEvent(msg *Message, ctx Context) {
+	ev, ok := decodeKick(msg)
+	if !ok {
+		return
+	}
+
+	if ctx.Server().EqualFold(ctx.Connection().CurrentNick(), ev.Nick) {
 		// we were kicked
-		ctx.Channels().Remove(room)
-		log.Debugf("removing channel '%s'", room)
-	} else if ch, ok := ctx.Channels().Get(room); ok {
-		ch.Users().RemoveName(kickee)
-		log.Debugf("removing '%s' from channel '%s'", kickee, room)
+		ctx.Channels().Remove(ev.Channel)
+		log.Debugf("removing channel '%s'", ev.Channel)
+	} else if ch, ok := ctx.Channels().Get(ev.Channel); ok {
+		ch.Users().RemoveName(ev.Nick)
+		log.Debugf("removing '%s' from channel '%s'", ev.Nick, ev.Channel)
 	}
 }
 
-// QuitEvent updates the channels user list when a user quits
-func QuitEvent(msg *Message, ctx Context) {
-	ctx.Channels().forEach(msg.Source, func(ch *Channel) {
-		ch.Users().Remove(msg.Source)
-		log.Debugf("removing '%s' from channel '%s'", msg.Source.Nickname, ch.Name)
+// quitEvent updates the channels user list when a user quits
+func quitEvent(msg *Message, ctx Context) {
+	ev, ok := decodeQuit(msg)
+	if !ok {
+		return
+	}
+
+	ctx.Channels().forEach(ev.User, func(ch *Channel) {
+		ch.Users().Remove(ev.User)
+		log.Debugf("removing '%s' from channel '%s'", ev.User.Nickname, ch.Name)
 	})
 }
 
-// NickEvent updates the user list when a nick change happens
-func NickEvent(msg *Message, ctx Context) {
-	clone, nick := msg.Source.Clone(), msg.Source.Nickname
-	msg.Source.Nickname = msg.Args[0]
+// nickEvent updates the user list when a nick change happens,
+// the users we know are renamed but the message is left alone for later handlers
+func nickEvent(msg *Message, ctx Context) {
+	ev, ok := decodeNick(msg)
+	if !ok {
+		return
+	}
+
+	clone, old := ev.User.Clone(), ev.User.Nickname
 
 	// update local, if its us
-	if clone.Nickname == ctx.Connection().CurrentNick() {
-		ctx.Connection().UpdateNick(msg.Args[0])
+	if ctx.Server().EqualFold(old, ctx.Connection().CurrentNick()) {
+		ctx.Connection().UpdateNick(ev.Nick)
 	}
 
 	ctx.Channels().forEach(clone, func(ch *Channel) {
-		ch.Users().RemoveName(nick)
-		ch.Users().Add(msg.Source)
-		log.Debugf("changing nick '%s' to '%s' on from channel '%s'", nick, msg.Source.Nickname, ch.Name)
+		ch.Users().modify(old, func(u *User) { u.Nickname = ev.Nick })
+		log.Debugf("changing nick '%s' to '%s' on from channel '%s'", old, ev.Nick, ch.Name)
+	})
+}
+
+// ChghostEvent updates a user's username and hostname when the server changes them,
+// 'CHGHOST <new user> <new host>'
+func ChghostEvent(msg *Message, ctx Context) {
+	if msg.Source == nil || len(msg.Params) < 2 {
+		return
+	}
+
+	nick := msg.Source.Nickname
+	ctx.Channels().forEach(msg.Source, func(ch *Channel) {
+		ch.Users().modify(nick, func(u *User) { u.Username, u.Hostname = msg.Params[0], msg.Params[1] })
+		log.Debugf("changing host of '%s' in channel '%s'", nick, ch.Name)
 	})
 }
 
-// TopicEvent updates the channel topic when it changes
-func TopicEvent(msg *Message, ctx Context) {
-	if ch, ok := ctx.Channels().Get(msg.Args[0]); ok {
-		ch.Topic(msg.Message)
+// topicEvent updates the channel topic, and who set it, when it changes
+func topicEvent(msg *Message, ctx Context) {
+	ev, ok := decodeTopic(msg)
+	if !ok || ev.By == nil {
+		return
+	}
+
+	if ch, ok := ctx.Channels().Get(ev.Channel); ok {
+		at, ok := msg.Time()
+		if !ok {
+			at = time.Now()
+		}
+
+		ch.Topic(ev.Topic)
+		ch.setTopicInfo(ev.By.Mask(), at)
+	}
+}
+
+// TopicReplyEvent sets the channel topic from RPL_TOPIC (332), or clears it for RPL_NOTOPIC (331)
+func TopicReplyEvent(msg *Message, ctx Context) {
+	// <client> <channel> :<topic>
+	if len(msg.Params) < 3 {
+		return
+	}
+
+	if ch, ok := ctx.Channels().Get(msg.Params[1]); ok {
+		if msg.Command == "331" {
+			ch.Topic("")
+			ch.setTopicInfo("", time.Time{})
+			return
+		}
+		ch.Topic(msg.Params[2])
+	}
+}
+
+// TopicWhoTimeEvent sets who set the channel topic and when from RPL_TOPICWHOTIME (333)
+func TopicWhoTimeEvent(msg *Message, ctx Context) {
+	// <client> <channel> <nick> <setat>
+	if len(msg.Params) < 4 {
+		return
+	}
+
+	if ch, ok := ctx.Channels().Get(msg.Params[1]); ok {
+		ts, err := strconv.ParseInt(msg.Params[3], 10, 64)
+		if err != nil {
+			return
+		}
+		ch.setTopicInfo(msg.Params[2], time.Unix(ts, 0))
+	}
+}
+
+// modeEvent updates the channel's modes, and its users' membership modes, when they change
+func modeEvent(msg *Message, ctx Context) {
+	ev, ok := decodeMode(msg, ctx)
+	if !ok {
+		return
+	}
+
+	ch, ok := ctx.Channels().Get(ev.Channel)
+	if !ok {
+		return
+	}
+
+	var setter string
+	if ev.Setter != nil {
+		setter = ev.Setter.Mask()
+	}
+
+	at, ok := msg.Time()
+	if !ok {
+		at = time.Now()
+	}
+
+	ch.applyModes(ctx.Server(), setter, at, ev.Changes)
+	log.Debugf("changing modes '%s' in channel '%s'", msg.Params[1:], ch.Name)
+}
+
+// ChannelModeIsEvent sets the channel's modes from a reply to a mode query (324)
+func ChannelModeIsEvent(msg *Message, ctx Context) {
+	// <client> <channel> <modestring> <mode arguments>...
+	if len(msg.Params) < 3 {
+		return
+	}
+
+	if ch, ok := ctx.Channels().Get(msg.Params[1]); ok {
+		ch.resetModes(ctx.Server(), ParseModes(ctx.Server(), msg.Params[2], msg.Params[3:]))
+		log.Debugf("setting modes '%s' in channel '%s'", msg.Params[2:], ch.Name)
+	}
+}
+
+// NamesEvent collects the users, and their membership modes, from a NAMES reply (353).
+// With userhost-in-names the entries are full 'nick!user@host' masks
+func NamesEvent(msg *Message, ctx Context) {
+	if len(msg.Params) < 4 {
+		return
+	}
+
+	ch, ok := ctx.Channels().Get(msg.Params[2])
+	if !ok {
+		return
+	}
+
+	entries := strings.Fields(msg.Params[3])
+	users, modes := make([]*User, len(entries)), make([]string, len(entries))
+	for i, entry := range entries {
+		var rest string
+		modes[i], rest = ctx.Server().splitPrefix(entry)
+		users[i] = NewUser(rest)
+	}
+	ch.addNames(users, modes)
+}
+
+// EndOfNamesEvent replaces the channel user list with the collected NAMES reply (366)
+func EndOfNamesEvent(msg *Message, ctx Context) {
+	if len(msg.Params) < 2 {
+		return
+	}
+
+	if ch, ok := ctx.Channels().Get(msg.Params[1]); ok {
+		ch.endNames()
+		log.Debugf("updated users for channel '%s'", ch.Name)
 	}
 }
 
-// PrivmsgEvent updates the user list when a user speaks
-func PrivmsgEvent(msg *Message, ctx Context) {
-	if msg.Args[0][0] != 35 {
+// privmsgEvent updates the user list when a user speaks
+func privmsgEvent(msg *Message, ctx Context) {
+	ev, ok := decodePrivmsg(msg)
+	if !ok || !ctx.Server().IsChannel(ev.Target) {
 		return // private message
 	}
 
-	if ch, ok := ctx.Channels().Get(msg.Args[0]); ok {
-		ch.Users().Update(msg.Source.Nickname, msg.Source)
+	if ch, ok := ctx.Channels().Get(ev.Target); ok {
+		ch.Users().seen(ev.From)
 	}
 }
 
-// ErrorEvent handles any 'ERROR's from the server
+// ErrorEvent handles any 'ERROR's from the server,
+// the server will close the connection after sending one
 func ErrorEvent(msg *Message, ctx Context) {
-	log.Fatalf(msg.String())
+	log.Warnf("server error: %s", msg)
 }
 
 // helpers
@@ -0,0 +1,135 @@
+package irc
+
+import (
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEvents(t *testing.T) {
+	mock := NewMockConn()
+	Convey("events should", t, func() {
+		ev := newEvents()
+		mock.ev = ev
+
+		var calls []string
+		record := func(name string) Event {
+			return func(msg *Message, ctx Context) { calls = append(calls, name) }
+		}
+
+		Convey("dispatch to each event in order", func() {
+			ev.Add("PRIVMSG", record("a"))
+			ev.Add("privmsg", record("b"))
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			So(calls, ShouldResemble, []string{"a", "b"})
+		})
+
+		Convey("remove an event by its handle", func() {
+			a := ev.Add("PRIVMSG", record("a"))
+			b := ev.Add("PRIVMSG", record("b"))
+			So(a.ID(), ShouldNotEqual, b.ID())
+
+			So(a.Remove(), ShouldBeTrue)
+			So(a.Remove(), ShouldBeFalse)
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			So(calls, ShouldResemble, []string{"b"})
+		})
+
+		Convey("remove an event while dispatching", func() {
+			var h *Handle
+			h = ev.Add("PRIVMSG", func(msg *Message, ctx Context) {
+				calls = append(calls, "a")
+				h.Remove()
+			})
+			ev.Add("PRIVMSG", record("b"))
+
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			So(calls, ShouldResemble, []string{"a", "b", "b"})
+		})
+
+		Convey("run a once event only once", func() {
+			ev.Once("PRIVMSG", record("once"))
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			So(calls, ShouldResemble, []string{"once"})
+		})
+
+		Convey("add a once event while dispatching", func() {
+			msg, _ := ParseMessage(":foo PRIVMSG #hello :hi")
+			stop, done := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						ev.Dispatch(msg, mock)
+					}
+				}
+			}()
+
+			var count int32
+			fired := make(chan struct{})
+			ev.Once("PRIVMSG", func(msg *Message, ctx Context) {
+				atomic.AddInt32(&count, 1)
+				close(fired)
+			})
+			<-fired
+			close(stop)
+			<-done
+
+			So(atomic.LoadInt32(&count), ShouldEqual, 1)
+		})
+
+		Convey("clear the events for a command", func() {
+			ev.Add("PRIVMSG", record("a"))
+			ev.Add("NOTICE", record("b"))
+			ev.Clear("privmsg")
+
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			mock.dispatch(":foo NOTICE #hello :hi")
+			So(calls, ShouldResemble, []string{"b"})
+		})
+
+		Convey("let typed events be removed", func() {
+			h := ev.OnPrivmsg(func(e *PrivmsgEvent, ctx Context) { calls = append(calls, e.Text) })
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			h.Remove()
+			mock.dispatch(":foo PRIVMSG #hello :hi")
+			So(calls, ShouldResemble, []string{"hi"})
+		})
+	})
+
+	Convey("the default events should be replaceable", t, func() {
+		ev := NewEvents()
+		mock.ev = ev
+
+		var pinged bool
+		ev.Clear("PING")
+		ev.Add("PING", func(msg *Message, ctx Context) { pinged = true })
+
+		mock.dispatch("PING :irc.localhost")
+		So(pinged, ShouldBeTrue)
+	})
+
+	Convey("the default events should be removable on their own", t, func() {
+		ev := NewEvents()
+		mock := NewMockConn()
+		mock.ev = ev
+
+		var joined bool
+		ev.Add("JOIN", func(msg *Message, ctx Context) { joined = true })
+
+		hs := ev.Default("JOIN")
+		So(hs, ShouldHaveLength, 1)
+		So(hs[0].Remove(), ShouldBeTrue)
+		So(ev.Default("JOIN"), ShouldBeEmpty)
+
+		mock.Do(func() { mock.Raw("JOIN") }, mock.local, "JOIN", "#hello")
+		So(joined, ShouldBeTrue)
+		So(mock.ch.Has("#hello"), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,298 @@
+package irc
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ServerInfo holds what the server told us about itself while we registered,
+// from RPL_WELCOME (001) through RPL_ISUPPORT (005).
+// Its accessors return the RFC defaults for anything the server didn't send
+type ServerInfo struct {
+	name, version string
+	userModes     string
+	tokens        map[string]string
+
+	sync.RWMutex
+}
+
+// NewServerInfo returns a ServerInfo with only the defaults
+func NewServerInfo() *ServerInfo {
+	return &ServerInfo{tokens: make(map[string]string)}
+}
+
+// defaultServerInfo is used by collections that weren't given a server, it is never updated
+var defaultServerInfo = NewServerInfo()
+
+// serverInfo returns s, or the defaults if it is nil
+func serverInfo(s *ServerInfo) *ServerInfo {
+	if s == nil {
+		return defaultServerInfo
+	}
+	return s
+}
+
+// Name returns the server's name
+func (s *ServerInfo) Name() string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.name
+}
+
+// Version returns the server's software version, from RPL_MYINFO
+func (s *ServerInfo) Version() string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.version
+}
+
+// UserModes returns the user modes the server supports, from RPL_MYINFO
+func (s *ServerInfo) UserModes() string {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.userModes
+}
+
+// Token returns the raw value of an ISUPPORT token, and whether the server sent it
+func (s *ServerInfo) Token(name string) (value string, ok bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	value, ok = s.tokens[strings.ToUpper(name)]
+	return
+}
+
+// Tokens returns a copy of every ISUPPORT token the server sent
+func (s *ServerInfo) Tokens() map[string]string {
+	s.RLock()
+	defer s.RUnlock()
+
+	out := make(map[string]string, len(s.tokens))
+	for k, v := range s.tokens {
+		out[k] = v
+	}
+	return out
+}
+
+// Network returns the NETWORK name
+func (s *ServerInfo) Network() string {
+	return s.str("NETWORK", "")
+}
+
+// ChanTypes returns the CHANTYPES, the prefixes of channel names
+func (s *ServerInfo) ChanTypes() string {
+	return s.str("CHANTYPES", "#&")
+}
+
+// IsChannel returns whether name is a channel, rather than a nick
+func (s *ServerInfo) IsChannel(name string) bool {
+	return name != "" && strings.IndexByte(s.ChanTypes(), name[0]) > -1
+}
+
+// Prefix returns the PREFIX membership modes and their matching symbols,
+// ordered from the highest rank, e.g. "ov" and "@+"
+func (s *ServerInfo) Prefix() (modes, symbols string) {
+	v := s.str("PREFIX", "(ov)@+")
+	if !strings.HasPrefix(v, "(") {
+		return "", ""
+	}
+
+	modes, symbols, _ = strings.Cut(v[1:], ")")
+	if len(modes) != len(symbols) {
+		return "", ""
+	}
+	return
+}
+
+// splitPrefix splits the membership symbols, e.g. "@+", off a NAMES entry
+// and returns the modes they stand for and the rest of the entry
+func (s *ServerInfo) splitPrefix(entry string) (modes, rest string) {
+	prefix, symbols := s.Prefix()
+
+	i := 0
+	var out []byte
+	for ; i < len(entry); i++ {
+		n := strings.IndexByte(symbols, entry[i])
+		if n < 0 {
+			break
+		}
+		out = append(out, prefix[n])
+	}
+	return string(out), entry[i:]
+}
+
+// ChanModes returns the CHANMODES, the channel modes split into their 4 types:
+// A list modes, B modes that always take a param, C modes that take a param
+// when being set, D modes that never take a param
+func (s *ServerInfo) ChanModes() [4]string {
+	var out [4]string
+	copy(out[:], strings.SplitN(s.str("CHANMODES", "beI,k,l,imnpst"), ",", 4))
+	return out
+}
+
+// CaseMapping returns the CASEMAPPING used to compare nicks and channels
+func (s *ServerInfo) CaseMapping() string {
+	return strings.ToLower(s.str("CASEMAPPING", "rfc1459"))
+}
+
+// Fold returns name folded with the server's CASEMAPPING
+func (s *ServerInfo) Fold(name string) string {
+	return FoldCase(s.CaseMapping(), name)
+}
+
+// EqualFold returns whether a and b are the same name under the server's CASEMAPPING
+func (s *ServerInfo) EqualFold(a, b string) bool {
+	return s.Fold(a) == s.Fold(b)
+}
+
+// NickLen returns the NICKLEN, the longest nick the server allows
+func (s *ServerInfo) NickLen() int {
+	return s.num("NICKLEN", 9)
+}
+
+// TopicLen returns the TOPICLEN, the longest topic the server allows, or 0 if there is no limit
+func (s *ServerInfo) TopicLen() int {
+	return s.num("TOPICLEN", 0)
+}
+
+// ChannelLen returns the CHANNELLEN, the longest channel name the server allows
+func (s *ServerInfo) ChannelLen() int {
+	return s.num("CHANNELLEN", 200)
+}
+
+// Modes returns MODES, how many modes with a param can be sent in one MODE
+func (s *ServerInfo) Modes() int {
+	return s.num("MODES", 3)
+}
+
+// LineLen returns the LINELEN, the longest line the server accepts, including the CRLF
+func (s *ServerInfo) LineLen() int {
+	return s.num("LINELEN", maxLineLength)
+}
+
+// TargMax returns the TARGMAX, how many targets each command accepts,
+// a command that is mapped to 0 has no limit
+func (s *ServerInfo) TargMax() map[string]int {
+	out := make(map[string]int)
+	for _, pair := range strings.Split(s.str("TARGMAX", ""), ",") {
+		cmd, n, ok := strings.Cut(pair, ":")
+		if !ok || cmd == "" {
+			continue
+		}
+		out[strings.ToUpper(cmd)], _ = strconv.Atoi(n)
+	}
+	return out
+}
+
+// Monitor returns the MONITOR limit, and whether the server supports MONITOR,
+// a limit of 0 means there is none
+func (s *ServerInfo) Monitor() (limit int, ok bool) {
+	if _, ok = s.Token("MONITOR"); ok {
+		limit = s.num("MONITOR", 0)
+	}
+	return
+}
+
+// WHOX returns whether the server supports WHOX
+func (s *ServerInfo) WHOX() bool {
+	_, ok := s.Token("WHOX")
+	return ok
+}
+
+// str returns the token's value, or def if the server didn't send it, or sent it empty
+func (s *ServerInfo) str(name, def string) string {
+	if v, ok := s.Token(name); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// num returns the token's value as a number, or def
+func (s *ServerInfo) num(name string, def int) int {
+	if n, err := strconv.Atoi(s.str(name, "")); err == nil {
+		return n
+	}
+	return def
+}
+
+func (s *ServerInfo) reset() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.name, s.version, s.userModes = "", "", ""
+	s.tokens = make(map[string]string)
+}
+
+// welcomeEvent learns the server's name from RPL_WELCOME
+func (s *ServerInfo) welcomeEvent(msg *Message, ctx Context) {
+	if msg.Source == nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.name = msg.Source.Nickname
+}
+
+// myInfoEvent handles RPL_MYINFO, '<nick> <server> <version> <user modes> <channel modes>'
+func (s *ServerInfo) myInfoEvent(msg *Message, ctx Context) {
+	if len(msg.Params) < 4 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.name, s.version, s.userModes = msg.Params[1], msg.Params[2], msg.Params[3]
+}
+
+// isupportEvent handles RPL_ISUPPORT, '<nick> <token>[=<value>]... :are supported by this server'
+func (s *ServerInfo) isupportEvent(msg *Message, ctx Context) {
+	if len(msg.Params) < 2 {
+		return
+	}
+
+	tokens := msg.Params[1:]
+	if msg.Trailing {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, tok := range tokens {
+		// a '-TOKEN' means the server no longer supports it
+		if strings.HasPrefix(tok, "-") {
+			delete(s.tokens, strings.ToUpper(tok[1:]))
+			continue
+		}
+
+		name, value, _ := strings.Cut(tok, "=")
+		s.tokens[strings.ToUpper(name)] = unescapeISupport(value)
+	}
+}
+
+// unescapeISupport replaces the '\xHH' escapes in a token's value
+func unescapeISupport(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if b, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				buf.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
@@ -0,0 +1,93 @@
+package irc
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestServerInfo(t *testing.T) {
+	feed := func(s *ServerInfo, lines ...string) {
+		for _, line := range lines {
+			msg, err := ParseMessage(line)
+			So(err, ShouldBeNil)
+
+			switch msg.Command {
+			case "001":
+				s.welcomeEvent(msg, nil)
+			case "004":
+				s.myInfoEvent(msg, nil)
+			case "005":
+				s.isupportEvent(msg, nil)
+			}
+		}
+	}
+
+	Convey("server info should", t, func() {
+		s := NewServerInfo()
+
+		Convey("have the defaults", func() {
+			So(s.ChanTypes(), ShouldEqual, "#&")
+			modes, symbols := s.Prefix()
+			So(modes, ShouldEqual, "ov")
+			So(symbols, ShouldEqual, "@+")
+			So(s.CaseMapping(), ShouldEqual, "rfc1459")
+			So(s.NickLen(), ShouldEqual, 9)
+			So(s.LineLen(), ShouldEqual, 512)
+			_, ok := s.Monitor()
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("parse the registration burst", func() {
+			feed(s,
+				":irc.localhost 001 anolis :Welcome to the network",
+				":irc.localhost 004 anolis irc.localhost ircd-1.0 iowx biklmnopstv bklov",
+				":irc.localhost 005 anolis CHANTYPES=#& PREFIX=(qaohv)~&@%+ CHANMODES=beI,k,l,imnpst CASEMAPPING=ascii :are supported by this server",
+				":irc.localhost 005 anolis NICKLEN=30 TOPICLEN=390 MODES=4 TARGMAX=PRIVMSG:4,NOTICE:4,JOIN: NETWORK=Local\\x20Net MONITOR=100 WHOX :are supported by this server",
+			)
+
+			So(s.Name(), ShouldEqual, "irc.localhost")
+			So(s.Version(), ShouldEqual, "ircd-1.0")
+			So(s.UserModes(), ShouldEqual, "iowx")
+			So(s.ChanTypes(), ShouldEqual, "#&")
+			modes, symbols := s.Prefix()
+			So(modes, ShouldEqual, "qaohv")
+			So(symbols, ShouldEqual, "~&@%+")
+			So(s.ChanModes(), ShouldResemble, [4]string{"beI", "k", "l", "imnpst"})
+			So(s.CaseMapping(), ShouldEqual, "ascii")
+			So(s.NickLen(), ShouldEqual, 30)
+			So(s.TopicLen(), ShouldEqual, 390)
+			So(s.Modes(), ShouldEqual, 4)
+			So(s.TargMax(), ShouldResemble, map[string]int{"PRIVMSG": 4, "NOTICE": 4, "JOIN": 0})
+			So(s.Network(), ShouldEqual, "Local Net")
+			So(s.WHOX(), ShouldBeTrue)
+
+			limit, ok := s.Monitor()
+			So(ok, ShouldBeTrue)
+			So(limit, ShouldEqual, 100)
+
+			Convey("and forget negated tokens", func() {
+				feed(s, ":irc.localhost 005 anolis -WHOX -NICKLEN :are supported by this server")
+				So(s.WHOX(), ShouldBeFalse)
+				So(s.NickLen(), ShouldEqual, 9)
+			})
+		})
+
+		Convey("keep unknown tokens", func() {
+			feed(s, ":irc.localhost 005 anolis FOO=bar BAZ :are supported by this server")
+			v, ok := s.Token("foo")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, "bar")
+			So(s.Tokens(), ShouldResemble, map[string]string{"FOO": "bar", "BAZ": ""})
+		})
+
+		Convey("tell channels from nicks", func() {
+			feed(s, ":irc.localhost 005 anolis CHANTYPES=#+ :are supported by this server")
+			So(s.IsChannel("#foo"), ShouldBeTrue)
+			So(s.IsChannel("+foo"), ShouldBeTrue)
+			So(s.IsChannel("&foo"), ShouldBeFalse)
+			So(s.IsChannel("foo"), ShouldBeFalse)
+			So(s.IsChannel(""), ShouldBeFalse)
+		})
+	})
+}
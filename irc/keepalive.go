@@ -0,0 +1,148 @@
+package irc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// keepalive pings the server, to measure the lag and notice when the connection is dead
+type keepalive struct {
+	interval, timeout time.Duration
+
+	last  time.Time // when we last read from the server
+	token string    // the token of the ping waiting for a PONG, if any
+	sent  time.Time
+	lag   time.Duration
+	n     int
+
+	sync.Mutex
+}
+
+// reset forgets the last connection's pings
+func (k *keepalive) reset() {
+	k.Lock()
+	defer k.Unlock()
+
+	k.last, k.token, k.lag = time.Now(), "", 0
+}
+
+// received notes that the server sent us something
+func (k *keepalive) received() {
+	k.Lock()
+	defer k.Unlock()
+
+	k.last = time.Now()
+}
+
+// idle returns how long it's been since the server sent us something
+func (k *keepalive) idle() time.Duration {
+	k.Lock()
+	defer k.Unlock()
+
+	return time.Since(k.last)
+}
+
+// ping returns the token for a new ping, and whether one should be sent,
+// there's only one ping waiting for a PONG at a time
+func (k *keepalive) ping() (string, bool) {
+	k.Lock()
+	defer k.Unlock()
+
+	if k.token != "" {
+		return "", false
+	}
+
+	k.n++
+	k.token, k.sent = fmt.Sprintf("anolis-%d", k.n), time.Now()
+	return k.token, true
+}
+
+// pong measures the lag if token is the ping we're waiting for
+func (k *keepalive) pong(token string) {
+	k.Lock()
+	defer k.Unlock()
+
+	if token == "" || token != k.token {
+		return
+	}
+	k.token, k.lag = "", time.Since(k.sent)
+}
+
+// Lag returns the round trip of the last ping, or how long
+// the current one has been waiting, if that is longer
+func (k *keepalive) Lag() time.Duration {
+	k.Lock()
+	defer k.Unlock()
+
+	if k.token != "" {
+		if wait := time.Since(k.sent); wait > k.lag {
+			return wait
+		}
+	}
+	return k.lag
+}
+
+// Lag returns the round trip to the server, measured with the keepalive's pings.
+// It is 0 until a ping has been answered, or if the keepalive is turned off
+func (c *Connection) Lag() time.Duration {
+	return c.alive.Lag()
+}
+
+// keepaliveLoop pings the server every PingInterval once we're registered, and drops
+// the connection when the server hasn't sent anything for PingTimeout, registered or not
+func (c *Connection) keepaliveLoop() {
+	tick := time.NewTicker(c.alive.interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-tick.C:
+		}
+
+		// there's nothing to time out while we wait to reconnect
+		if !c.isConnected() {
+			continue
+		}
+
+		if idle := c.alive.idle(); c.alive.timeout > 0 && idle >= c.alive.timeout {
+			c.timedOut()
+			continue
+		}
+
+		if !c.isRegistered() {
+			continue
+		}
+
+		if token, ok := c.alive.ping(); ok {
+			log.Debugf(">> PING %s", token)
+			c.queue.push("PING "+token, true)
+		}
+	}
+}
+
+// timedOut hangs up on the server, the read fails and reports a *TimeoutError
+func (c *Connection) timedOut() {
+	c.Lock()
+	if c.reason != nil {
+		// the connection is already going away
+		c.Unlock()
+		return
+	}
+	c.reason = &TimeoutError{c.alive.timeout}
+	conn := c.conn
+	c.Unlock()
+
+	log.Warnf("no reply from server in %s", c.alive.timeout)
+	conn.Close()
+}
+
+// pongEvent measures the lag from the reply to our ping
+func (c *Connection) pongEvent(msg *Message, ctx Context) {
+	if len(msg.Params) == 0 {
+		return
+	}
+	c.alive.pong(lastString(msg.Params))
+}
@@ -0,0 +1,88 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeepalive(t *testing.T) {
+	Convey("keepalive should", t, func() {
+		k := &keepalive{}
+		k.reset()
+
+		Convey("wait for one ping at a time", func() {
+			token, ok := k.ping()
+			So(ok, ShouldBeTrue)
+			So(token, ShouldEqual, "anolis-1")
+
+			_, ok = k.ping()
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("measure the lag from the matching PONG", func() {
+			token, _ := k.ping()
+			time.Sleep(5 * time.Millisecond)
+
+			k.pong("anolis-0")
+			_, ok := k.ping()
+			So(ok, ShouldBeFalse)
+
+			k.pong(token)
+			So(k.Lag(), ShouldBeGreaterThanOrEqualTo, 5*time.Millisecond)
+
+			token, ok = k.ping()
+			So(ok, ShouldBeTrue)
+			So(token, ShouldEqual, "anolis-2")
+		})
+	})
+}
+
+func TestDial_Keepalive(t *testing.T) {
+	Convey("a connection with a keepalive should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.PingInterval, conf.PingTimeout = 10*time.Millisecond, 100*time.Millisecond
+
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+
+		Convey("ping the server and measure the lag", func() {
+			So(client.Expect("PING"), ShouldEqual, "PING anolis-1")
+			time.Sleep(5 * time.Millisecond)
+			client.Send(":irc.localhost PONG irc.localhost :anolis-1")
+
+			So(client.Expect("PING"), ShouldEqual, "PING anolis-2")
+			So(ctx.Connection().Lag(), ShouldBeGreaterThanOrEqualTo, 5*time.Millisecond)
+		})
+
+		Convey("report a TimeoutError when the server goes quiet", func() {
+			So(waitForClose(ctx), ShouldResemble, &TimeoutError{100 * time.Millisecond})
+		})
+	})
+
+	Convey("a connection with a keepalive should time out while registering", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.PingInterval, conf.PingTimeout = 10*time.Millisecond, 100*time.Millisecond
+
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		// the server accepts us, but never says anything
+		client := srv.Accept()
+		defer client.Close()
+
+		So(waitForClose(ctx), ShouldResemble, &TimeoutError{100 * time.Millisecond})
+	})
+}
@@ -0,0 +1,141 @@
+package irc
+
+import (
+	"strconv"
+	"time"
+)
+
+// ListEntry is a mask in one of a channel's list modes, e.g. a ban
+type ListEntry struct {
+	Mask   string
+	Setter string    // who set it, if the server said
+	Time   time.Time // when it was set, if the server said
+}
+
+// listReplies are the list modes for their list and end of list numerics
+var listReplies = map[string]byte{
+	"367": 'b', "368": 'b', // RPL_BANLIST, RPL_ENDOFBANLIST
+	"348": 'e', "349": 'e', // RPL_EXCEPTLIST, RPL_ENDOFEXCEPTLIST
+	"346": 'I', "347": 'I', // RPL_INVITELIST, RPL_ENDOFINVITELIST
+}
+
+// Bans returns the channel's ban list (+b)
+func (c *Channel) Bans() []ListEntry {
+	return c.List('b')
+}
+
+// Excepts returns the channel's ban exception list (+e)
+func (c *Channel) Excepts() []ListEntry {
+	return c.List('e')
+}
+
+// Invites returns the channel's invite exception list (+I)
+func (c *Channel) Invites() []ListEntry {
+	return c.List('I')
+}
+
+// List returns the entries in one of the list modes, e.g. the bans for 'b'
+func (c *Channel) List(mode byte) []ListEntry {
+	c.RLock()
+	defer c.RUnlock()
+
+	return append([]ListEntry(nil), c.lists[mode]...)
+}
+
+// addListEntry adds an entry from a list reply to the list being collected
+func (c *Channel) addListEntry(mode byte, entry ListEntry) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.pending == nil {
+		c.pending = make(map[byte][]ListEntry)
+	}
+	c.pending[mode] = append(c.pending[mode], entry)
+}
+
+// endList replaces the list with the collected list replies
+func (c *Channel) endList(mode byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.lists[mode] = c.pending[mode]
+	delete(c.pending, mode)
+}
+
+// listQueryEvent asks for the lists of the channels we join,
+// the exception lists only if the server has them
+func (c *Connection) listQueryEvent(msg *Message, ctx Context) {
+	if msg.Source == nil || len(msg.Params) == 0 {
+		return
+	}
+
+	if !c.server.EqualFold(msg.Source.Nickname, c.CurrentNick()) {
+		return
+	}
+
+	room := msg.Params[0]
+	c.send(NewMessage("MODE", room, "+b"))
+	if _, ok := c.server.Token("EXCEPTS"); ok {
+		c.send(NewMessage("MODE", room, "+e"))
+	}
+	if _, ok := c.server.Token("INVEX"); ok {
+		c.send(NewMessage("MODE", room, "+I"))
+	}
+}
+
+// ListEvent collects an entry from a ban, exception or invite list reply (367, 348, 346)
+func ListEvent(msg *Message, ctx Context) {
+	// <client> <channel> <mask> [<who> <set-ts>]
+	if len(msg.Params) < 3 {
+		return
+	}
+
+	ch, ok := ctx.Channels().Get(msg.Params[1])
+	if !ok {
+		return
+	}
+
+	entry := ListEntry{Mask: msg.Params[2]}
+	if len(msg.Params) > 4 {
+		entry.Setter = msg.Params[3]
+		if ts, err := strconv.ParseInt(msg.Params[4], 10, 64); err == nil {
+			entry.Time = time.Unix(ts, 0)
+		}
+	}
+	ch.addListEntry(listReplies[msg.Command], entry)
+}
+
+// EndOfListEvent replaces the channel's list with the collected replies (368, 349, 347)
+func EndOfListEvent(msg *Message, ctx Context) {
+	if len(msg.Params) < 2 {
+		return
+	}
+
+	if ch, ok := ctx.Channels().Get(msg.Params[1]); ok {
+		ch.endList(listReplies[msg.Command])
+		log.Debugf("updated the +%c list for channel '%s'", listReplies[msg.Command], ch.Name)
+	}
+}
+
+// Ban sets a ban on mask in room
+func (c *Connection) Ban(room, mask string) {
+	c.send(NewMessage("MODE", room, "+b", mask))
+}
+
+// Unban removes the ban on mask in room
+func (c *Connection) Unban(room, mask string) {
+	c.send(NewMessage("MODE", room, "-b", mask))
+}
+
+// KickBan bans user from room by their host, if we know it, and kicks them with msg
+func (c *Connection) KickBan(room, user, msg string) {
+	mask := user + "!*@*"
+	if ch, ok := c.ch.Get(room); ok {
+		if u, ok := ch.Users().Get(user); ok && u.Hostname != "" {
+			mask = "*!*@" + u.Hostname
+		}
+	}
+
+	c.Ban(room, mask)
+	c.Kick(room, user, msg)
+}
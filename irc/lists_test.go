@@ -0,0 +1,108 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// masks returns the masks of the entries
+func masks(entries []ListEntry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Mask)
+	}
+	return out
+}
+
+func TestConnection_Lists(t *testing.T) {
+	mock := NewMockConn()
+	Convey("connection should track channel lists", t, func() {
+		mock.Do(func() { mock.Join("#hello") }, mock.local, "JOIN", "#hello")
+		ch, _ := mock.Channels().Get("#hello")
+
+		Convey("from list replies", func() {
+			mock.dispatch(":irc.localhost 367 anolis #hello *!*@a foo!bar@baz 1700000000")
+			mock.dispatch(":irc.localhost 367 anolis #hello *!*@b")
+			So(ch.Bans(), ShouldBeEmpty)
+
+			mock.dispatch(":irc.localhost 368 anolis #hello :End of channel ban list")
+			So(ch.Bans(), ShouldResemble, []ListEntry{
+				{"*!*@a", "foo!bar@baz", time.Unix(1700000000, 0)},
+				{"*!*@b", "", time.Time{}},
+			})
+
+			mock.dispatch(":irc.localhost 348 anolis #hello *!*@c foo 1700000000")
+			mock.dispatch(":irc.localhost 349 anolis #hello :End of channel exception list")
+			mock.dispatch(":irc.localhost 347 anolis #hello :End of channel invite list")
+			So(masks(ch.Excepts()), ShouldResemble, []string{"*!*@c"})
+			So(ch.Invites(), ShouldBeEmpty)
+
+			Convey("replacing what was there", func() {
+				mock.dispatch(":irc.localhost 368 anolis #hello :End of channel ban list")
+				So(ch.Bans(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("as bans change", func() {
+			msg, _ := ParseMessage("@time=2024-01-02T03:04:05.000Z :foo!bar@baz MODE #hello +b *!*@a")
+			mock.ev.Dispatch(msg, mock)
+			So(ch.Bans(), ShouldResemble, []ListEntry{
+				{"*!*@a", "foo!bar@baz", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			})
+
+			msg, _ = ParseMessage(":foo!bar@baz MODE #hello -b *!*@A")
+			mock.ev.Dispatch(msg, mock)
+			So(ch.Bans(), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestDial_Lists(t *testing.T) {
+	Convey("dial should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.AutoWho = false
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+
+		Convey("ask for the lists of channels it joins", func() {
+			client.Send(":irc.localhost 005 anolis EXCEPTS :are supported by this server")
+			client.Send(":anolis!anolis@localhost JOIN #foo")
+			So(client.Expect("MODE #foo +"), ShouldEqual, "MODE #foo +b")
+			So(client.Expect("MODE #foo +"), ShouldEqual, "MODE #foo +e")
+		})
+
+		Convey("ban and unban", func() {
+			ctx.Commands().Ban("#foo", "*!*@a")
+			So(client.Expect("MODE"), ShouldEqual, "MODE #foo +b *!*@a")
+
+			ctx.Commands().Unban("#foo", "*!*@a")
+			So(client.Expect("MODE"), ShouldEqual, "MODE #foo -b *!*@a")
+		})
+
+		Convey("kickban by host when it knows it", func() {
+			client.Send(":anolis!anolis@localhost JOIN #foo")
+			So(eventually(func() bool { return ctx.Channels().Has("#foo") }), ShouldBeTrue)
+			client.Send(":bar!baz@example.com JOIN #foo")
+			So(eventually(func() bool {
+				ch, ok := ctx.Channels().Get("#foo")
+				return ok && ch.Users().HasName("bar")
+			}), ShouldBeTrue)
+
+			ctx.Commands().KickBan("#foo", "bar", "bye")
+			So(client.Expect("MODE #foo +b "), ShouldEqual, "MODE #foo +b *!*@example.com")
+			So(client.Expect("KICK"), ShouldEqual, "KICK #foo bar bye")
+
+			ctx.Commands().KickBan("#foo", "qux", "bye")
+			So(client.Expect("MODE #foo +b "), ShouldEqual, "MODE #foo +b qux!*@*")
+		})
+	})
+}
@@ -1,7 +1,10 @@
 package irc
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
+	"time"
 
 	bs "github.com/j6n/bufferedstring"
 )
@@ -9,10 +12,17 @@ import (
 // Message represents an IRC message
 type Message struct {
 	Raw     string
+	Tags    Tags  // optional
 	Source  *User // optional
 	Command string
-	Args    []string // 15 max
-	Message string   // optional
+
+	Params   []string // every parameter, including the trailing one
+	Trailing bool     // whether the last param was sent as a trailing param
+
+	// Args and Message split Params for compatibility,
+	// Args are the middle params and Message is the trailing one
+	Args    []string
+	Message string
 }
 
 func (m *Message) String() string {
@@ -28,3 +38,115 @@ func (m *Message) String() string {
 	buf.Append(m.Message)
 	return buf.String()
 }
+
+// maxLineLength is the longest a line can be, including the CRLF but not the tags
+const maxLineLength = 512
+
+// maxClientTagsLength is the longest the tags we send can be, including the '@' and space
+const maxClientTagsLength = 4096
+
+// NewMessage returns a new Message for sending the command with params
+func NewMessage(command string, params ...string) *Message {
+	return &Message{Command: command, Params: params}
+}
+
+// params returns Params, or for messages built with Args and Message, those.
+// An empty Message isn't sent as a trailing param
+func (m *Message) params() []string {
+	if len(m.Params) > 0 {
+		return m.Params
+	}
+	if m.Message == "" {
+		return m.Args
+	}
+	return append(m.Args[:len(m.Args):len(m.Args)], m.Message)
+}
+
+// Validate returns a *MessageError if the message can't be sent as it is
+func (m *Message) Validate() error {
+	if !validCommand(m.Command) {
+		return &MessageError{m.Command, "invalid command"}
+	}
+
+	params := m.params()
+	for i, p := range params {
+		if strings.ContainsAny(p, "\r\n\x00") {
+			return &MessageError{m.Command, "param contains CR, LF or NUL"}
+		}
+
+		if i < len(params)-1 && (p == "" || p[0] == ':' || strings.Contains(p, " ")) {
+			return &MessageError{m.Command, fmt.Sprintf("invalid middle param %q", p)}
+		}
+	}
+
+	for k, v := range m.Tags {
+		if k == "" || strings.ContainsAny(k, " ;=\r\n\x00") {
+			return &MessageError{m.Command, fmt.Sprintf("invalid tag %q", k)}
+		}
+		if strings.Contains(v, "\x00") {
+			return &MessageError{m.Command, fmt.Sprintf("tag %q value contains NUL", k)}
+		}
+	}
+
+	if n := len(m.Tags.String()) + 2; len(m.Tags) > 0 && n > maxClientTagsLength {
+		return &MessageError{m.Command, fmt.Sprintf("tags too long (%d bytes)", n)}
+	}
+
+	if n := len(m.line()) + 2; n > maxLineLength {
+		return &MessageError{m.Command, fmt.Sprintf("message too long (%d bytes)", n)}
+	}
+	return nil
+}
+
+// Bytes returns the message as it is sent, without the trailing CRLF.
+// CR, LF and NUL are stripped, Validate reports them instead
+func (m *Message) Bytes() []byte {
+	var buf bytes.Buffer
+	if len(m.Tags) > 0 {
+		buf.WriteString("@" + m.Tags.String() + " ")
+	}
+
+	buf.WriteString(m.line())
+	return buf.Bytes()
+}
+
+// line returns the message without its tags
+func (m *Message) line() string {
+	var buf bytes.Buffer
+	if m.Source != nil {
+		buf.WriteString(":" + m.Source.Mask() + " ")
+	}
+
+	buf.WriteString(stripInvalid(m.Command))
+	params := m.params()
+	for i, p := range params {
+		p = stripInvalid(p)
+
+		// the last param needs a ':' if it couldn't be read as a middle one
+		last := i == len(params)-1
+		if last && (m.Trailing || p == "" || p[0] == ':' || strings.Contains(p, " ")) {
+			p = ":" + p
+		}
+		buf.WriteString(" " + p)
+	}
+	return buf.String()
+}
+
+// stripInvalid removes the characters that would end, or corrupt, a line
+func stripInvalid(s string) string {
+	if !strings.ContainsAny(s, "\r\n\x00") {
+		return s
+	}
+	return strings.NewReplacer("\r", "", "\n", "", "\x00", "").Replace(s)
+}
+
+// Time returns when the message was sent, if the server sent a server-time tag
+func (m *Message) Time() (time.Time, bool) {
+	v, ok := m.Tags["time"]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, v)
+	return t, err == nil
+}
@@ -0,0 +1,98 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMessage(t *testing.T) {
+	Convey("message should", t, func() {
+		Convey("serialize with tags", func() {
+			msg := &Message{
+				Tags:    Tags{"+draft/reply": "a b;c"},
+				Command: "PRIVMSG",
+				Args:    []string{"#foobar"},
+				Message: "hello world",
+			}
+			raw := string(msg.Bytes())
+			So(raw, ShouldEqual, `@+draft/reply=a\sb\:c PRIVMSG #foobar :hello world`)
+
+			parsed, err := ParseMessage(raw)
+			So(err, ShouldBeNil)
+			So(parsed.Tags, ShouldResemble, msg.Tags)
+			So(parsed.Args, ShouldResemble, msg.Args)
+			So(parsed.Message, ShouldEqual, msg.Message)
+		})
+
+		Convey("serialize Args without a Message", func() {
+			msg := &Message{Command: "MODE", Args: []string{"#foobar", "+o", "foo"}}
+			So(msg.Validate(), ShouldBeNil)
+			So(string(msg.Bytes()), ShouldEqual, "MODE #foobar +o foo")
+		})
+
+		Convey("read the server time", func() {
+			msg, _ := ParseMessage("@time=2011-10-19T16:40:51.620Z :irc.localhost PING :1234")
+			ts, ok := msg.Time()
+			So(ok, ShouldBeTrue)
+			So(ts.Equal(time.Date(2011, 10, 19, 16, 40, 51, 620e6, time.UTC)), ShouldBeTrue)
+
+			msg, _ = ParseMessage("PING :1234")
+			_, ok = msg.Time()
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("only prefix the trailing param when it needs it", func() {
+			So(string(NewMessage("PRIVMSG", "#foobar", "hello").Bytes()), ShouldEqual, "PRIVMSG #foobar hello")
+			So(string(NewMessage("PRIVMSG", "#foobar", "hello world").Bytes()), ShouldEqual, "PRIVMSG #foobar :hello world")
+			So(string(NewMessage("PRIVMSG", "#foobar", ":)").Bytes()), ShouldEqual, "PRIVMSG #foobar ::)")
+			So(string(NewMessage("TOPIC", "#foobar", "").Bytes()), ShouldEqual, "TOPIC #foobar :")
+			So(string(NewMessage("QUIT").Bytes()), ShouldEqual, "QUIT")
+		})
+
+		Convey("round trip through ParseMessage", func() {
+			for _, params := range [][]string{
+				{"#foobar", "hello world"},
+				{"#foobar", ":)"},
+				{"#foobar", ""},
+				{"#foobar", "+o", "foo"},
+			} {
+				msg := NewMessage("PRIVMSG", params...)
+				msg.Tags = Tags{"+draft/reply": "a;b c"}
+				So(msg.Validate(), ShouldBeNil)
+
+				parsed, err := ParseMessage(string(msg.Bytes()))
+				So(err, ShouldBeNil)
+				So(parsed.Params, ShouldResemble, params)
+				So(parsed.Tags, ShouldResemble, msg.Tags)
+			}
+		})
+
+		Convey("reject messages that can't be sent", func() {
+			invalid := []*Message{
+				NewMessage("PRIVMSG", "#foobar", "hello\r\nQUIT :injected"),
+				NewMessage("PRIVMSG", "#foobar", "nul\x00"),
+				NewMessage("PRIVMSG", "#foo bar", "hello"),
+				NewMessage("PRIVMSG", "", "hello"),
+				NewMessage("PRIVMSG", ":#foobar", "hello"),
+				NewMessage("PRIV MSG", "#foobar", "hello"),
+				NewMessage("PRIVMSG", "#foobar", strings.Repeat("a", 500)),
+				{Command: "TAGMSG", Params: []string{"#foobar"}, Tags: Tags{"a;b": "c"}},
+				{Command: "TAGMSG", Params: []string{"#foobar"}, Tags: Tags{"+a": "b\x00c"}},
+			}
+			for _, msg := range invalid {
+				So(msg.Validate(), ShouldHaveSameTypeAs, &MessageError{})
+			}
+		})
+
+		Convey("strip CR, LF and NUL when serializing", func() {
+			msg := NewMessage("PRIVMSG", "#foobar", "hello\r\nQUIT :injected\x00")
+			So(string(msg.Bytes()), ShouldEqual, "PRIVMSG #foobar :helloQUIT :injected")
+
+			msg = &Message{Command: "TAGMSG", Params: []string{"#foobar"}, Tags: Tags{"+a": "b\x00c"}}
+			So(string(msg.Bytes()), ShouldEqual, "@+a=bc TAGMSG #foobar")
+		})
+	})
+}
@@ -0,0 +1,59 @@
+package irc
+
+import "strings"
+
+// ModeChange is a single mode being set or unset by a MODE message
+type ModeChange struct {
+	Add   bool
+	Mode  byte
+	Param string // empty if the mode doesn't take one
+}
+
+func (m ModeChange) String() string {
+	sign := "-"
+	if m.Add {
+		sign = "+"
+	}
+	if m.Param == "" {
+		return sign + string(m.Mode)
+	}
+	return sign + string(m.Mode) + " " + m.Param
+}
+
+// ParseModes splits a channel mode string and its params, e.g. "+ol-k nick 10 key",
+// into each change. It uses the server's CHANMODES and PREFIX to know which modes take a param
+func ParseModes(server *ServerInfo, modes string, params []string) []ModeChange {
+	chanModes := server.ChanModes()
+	prefix, _ := server.Prefix()
+
+	var out []ModeChange
+	add := true
+	for i := 0; i < len(modes); i++ {
+		switch m := modes[i]; m {
+		case '+', '-':
+			add = m == '+'
+		default:
+			change := ModeChange{Add: add, Mode: m}
+
+			// list and prefix modes, and B modes, always take a param, C modes only when set
+			takes := strings.IndexByte(chanModes[0]+chanModes[1]+prefix, m) >= 0 ||
+				(add && strings.IndexByte(chanModes[2], m) >= 0)
+			if takes && len(params) > 0 {
+				change.Param, params = params[0], params[1:]
+			}
+			out = append(out, change)
+		}
+	}
+	return out
+}
+
+// modeQueryEvent asks for the modes of the channels we join, the reply seeds the channel's modes
+func (c *Connection) modeQueryEvent(msg *Message, ctx Context) {
+	if msg.Source == nil || len(msg.Params) == 0 {
+		return
+	}
+
+	if c.server.EqualFold(msg.Source.Nickname, c.CurrentNick()) {
+		c.send(NewMessage("MODE", msg.Params[0]))
+	}
+}
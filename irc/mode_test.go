@@ -0,0 +1,141 @@
+package irc
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseModes(t *testing.T) {
+	Convey("parse modes should", t, func() {
+		s := NewServerInfo()
+
+		Convey("consume params for the modes that take them", func() {
+			out := ParseModes(s, "+ol-v+bn", []string{"foo", "10", "bar", "*!*@host"})
+			So(out, ShouldResemble, []ModeChange{
+				{true, 'o', "foo"},
+				{true, 'l', "10"},
+				{false, 'v', "bar"},
+				{true, 'b', "*!*@host"},
+				{true, 'n', ""},
+			})
+		})
+
+		Convey("not consume a param when unsetting a C mode", func() {
+			out := ParseModes(s, "-lk", []string{"key"})
+			So(out, ShouldResemble, []ModeChange{
+				{false, 'l', ""},
+				{false, 'k', "key"},
+			})
+		})
+
+		Convey("use the server's PREFIX", func() {
+			msg, _ := ParseMessage(":irc.localhost 005 anolis PREFIX=(qohv)~@%+ :are supported by this server")
+			s.isupportEvent(msg, nil)
+
+			out := ParseModes(s, "+qh", []string{"foo", "bar"})
+			So(out, ShouldResemble, []ModeChange{
+				{true, 'q', "foo"},
+				{true, 'h', "bar"},
+			})
+		})
+
+		Convey("format a change", func() {
+			So(ModeChange{true, 'o', "foo"}.String(), ShouldEqual, "+o foo")
+			So(ModeChange{false, 'm', ""}.String(), ShouldEqual, "-m")
+		})
+	})
+}
+
+func TestConnection_Modes(t *testing.T) {
+	mock := NewMockConn()
+	Convey("connection should track channel modes", t, func() {
+		mock.Do(func() { mock.Join("#hello") }, mock.local, "JOIN", "#hello")
+		mock.dispatch(":irc.localhost 324 anolis #hello +ntk key")
+		ch, _ := mock.Channels().Get("#hello")
+
+		Convey("from a mode query", func() {
+			So(ch.Modes(), ShouldEqual, "knt")
+			So(ch.Key(), ShouldEqual, "key")
+
+			mock.dispatch(":irc.localhost 324 anolis #hello +m")
+			So(ch.Modes(), ShouldEqual, "m")
+		})
+
+		Convey("when they change", func() {
+			mock.Do(func() { mock.Raw("MODE") }, mock.user, "MODE", "#hello", "+mil-nk", "10", "key")
+			So(ch.Modes(), ShouldEqual, "ilmt")
+			So(ch.HasMode('m'), ShouldBeTrue)
+			So(ch.HasMode('n'), ShouldBeFalse)
+			So(ch.Limit(), ShouldEqual, 10)
+			So(ch.Key(), ShouldEqual, "")
+
+			mock.Do(func() { mock.Raw("MODE") }, mock.user, "MODE", "#hello", "-l")
+			So(ch.HasMode('l'), ShouldBeFalse)
+			So(ch.Limit(), ShouldEqual, 0)
+		})
+
+		Convey("with their lists", func() {
+			mock.Do(func() { mock.Raw("MODE") }, mock.user, "MODE", "#hello", "+bbe", "*!*@a", "*!*@b", "*!*@c")
+			So(masks(ch.List('b')), ShouldResemble, []string{"*!*@a", "*!*@b"})
+			So(masks(ch.List('e')), ShouldResemble, []string{"*!*@c"})
+
+			mock.Do(func() { mock.Raw("MODE") }, mock.user, "MODE", "#hello", "-b", "*!*@a")
+			So(masks(ch.List('b')), ShouldResemble, []string{"*!*@b"})
+
+			mock.dispatch(":irc.localhost 324 anolis #hello +n")
+			So(masks(ch.List('b')), ShouldResemble, []string{"*!*@b"})
+		})
+
+		Convey("and tell handlers what changed", func() {
+			var got *ModeEvent
+			mock.ev.OnMode(func(ev *ModeEvent, ctx Context) {
+				So(ch.HasMode('m'), ShouldBeTrue)
+				got = ev
+			})
+			mock.Do(func() { mock.Raw("MODE") }, mock.user, "MODE", "#hello", "+mo", "foo")
+
+			So(got, ShouldNotBeNil)
+			So(got.Channel, ShouldEqual, "#hello")
+			So(got.Setter, ShouldEqual, mock.user)
+			So(got.Changes, ShouldResemble, []ModeChange{{true, 'm', ""}, {true, 'o', "foo"}})
+
+			got = nil
+			mock.Do(func() { mock.Raw("MODE") }, mock.local, "MODE", "anolis", "+i")
+			So(got, ShouldBeNil)
+		})
+
+		Convey("and let handlers look up the channel", func() {
+			var got *Channel
+			mock.ev.OnMode(func(ev *ModeEvent, ctx Context) {
+				got, _ = ev.Lookup(ctx)
+			})
+			mock.Do(func() { mock.Raw("MODE") }, mock.user, "MODE", "#hello", "+m")
+			So(got, ShouldEqual, ch)
+			So(got.HasMode('m'), ShouldBeTrue)
+		})
+	})
+}
+
+func TestDial_Modes(t *testing.T) {
+	Convey("dial should ask for the modes of channels it joins", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		ctx, err := Dial(srv.Configuration())
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+		client.Send(":anolis!anolis@localhost JOIN #foo")
+		So(client.Expect("MODE"), ShouldEqual, "MODE #foo")
+		So(eventually(func() bool { return ctx.Channels().Has("#foo") }), ShouldBeTrue)
+
+		client.Send(":irc.localhost 324 anolis #foo +nt")
+		So(eventually(func() bool {
+			ch, ok := ctx.Channels().Get("#foo")
+			return ok && ch.Modes() == "nt"
+		}), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,285 @@
+package irc
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NickGenerator returns the attempt'th replacement for a nick that is taken,
+// counting from 1, no longer than nickLen, or 0 if the server hasn't sent its NICKLEN yet.
+// Returning "" gives up
+type NickGenerator func(nick string, attempt, nickLen int) string
+
+// AppendNick is the default NickGenerator, it appends an underscore and then a number
+// to nick, e.g. "anolis_", "anolis2", "anolis3", shortening nick to fit in nickLen
+func AppendNick(nick string, attempt, nickLen int) string {
+	suffix := "_"
+	if attempt > 1 {
+		suffix = strconv.Itoa(attempt)
+	}
+
+	if nickLen > len(suffix) && len(nick)+len(suffix) > nickLen {
+		nick = nick[:nickLen-len(suffix)]
+	}
+	return nick + suffix
+}
+
+// knownNickLen returns the server's NICKLEN, or 0 if it hasn't sent one, e.g. while registering,
+// so we don't cut nicks down to the RFC's 9 characters on servers that allow longer ones
+func knownNickLen(server *ServerInfo) int {
+	if _, ok := server.Token("NICKLEN"); !ok {
+		return 0
+	}
+	return server.NickLen()
+}
+
+// nickPicker picks the nick to try next when the one we asked for is taken
+type nickPicker struct {
+	gen NickGenerator
+
+	base     string     // the nick we asked for
+	pending  string     // the nick we're waiting for the server to give us, if any
+	alts     []string   // the alternatives we haven't tried yet
+	attempt  int        // how many nicks we've generated
+	watching bool       // whether we're MONITORing our primary nick
+	asked    [][]string // the nicks in each ISON sent, waiting for their RPL_ISON, oldest first
+
+	sync.Mutex
+}
+
+// want waits for the server to give us nick, trying alts and then
+// generated nicks if it's taken
+func (p *nickPicker) want(nick string, alts []string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.base, p.pending, p.alts, p.attempt = nick, nick, alts, 0
+}
+
+// taken returns the nick to try now that nick is taken, or "" if there are none left.
+// It returns false if we weren't waiting for nick, e.g. when regaining our primary nick
+func (p *nickPicker) taken(nick string, server *ServerInfo) (next string, ours bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.pending == "" || !server.EqualFold(p.pending, nick) {
+		return "", false
+	}
+
+	switch {
+	case len(p.alts) > 0:
+		p.pending, p.alts = p.alts[0], p.alts[1:]
+	case p.gen != nil:
+		p.attempt++
+		p.pending = p.gen(p.base, p.attempt, knownNickLen(server))
+	default:
+		p.pending = ""
+	}
+	return p.pending, true
+}
+
+// done stops waiting, the server gave us a nick
+func (p *nickPicker) done() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.pending, p.alts = "", nil
+}
+
+// reset forgets what we asked the last connection
+func (p *nickPicker) reset() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.watching, p.asked = false, nil
+}
+
+// ask notes the nicks in an ISON we sent
+func (p *nickPicker) ask(nicks []string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.asked = append(p.asked, nicks)
+}
+
+// answered returns the nicks asked about by the ISON an RPL_ISON answers,
+// the server answers them in the order they were sent
+func (p *nickPicker) answered() []string {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(p.asked) == 0 {
+		return nil
+	}
+
+	nicks := p.asked[0]
+	p.asked = p.asked[1:]
+	return nicks
+}
+
+// watch sets whether we're MONITORing our primary nick, and returns whether that changed
+func (p *nickPicker) watch(on bool) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	changed := p.watching != on
+	p.watching = on
+	return changed
+}
+
+// nickTakenEvent tries another nick when the one we asked for is taken,
+// for ERR_NICKNAMEINUSE (433), ERR_NICKCOLLISION (436) and ERR_UNAVAILRESOURCE (437)
+func (c *Connection) nickTakenEvent(msg *Message, ctx Context) {
+	// 437 is also sent for channels we can't join
+	if len(msg.Params) < 2 || c.server.IsChannel(msg.Params[1]) {
+		return
+	}
+
+	next, ours := c.nicks.taken(msg.Params[1], c.server)
+	if !ours {
+		return
+	}
+
+	registered := c.isRegistered()
+	if next == "" {
+		if !registered {
+			// the server won't hang up on us, we'd never register
+			c.closeWith(&RegistrationError{msg.Command, msg.Message})
+			return
+		}
+		log.Warnf("nick '%s' is taken", msg.Params[1])
+		return
+	}
+
+	log.Infof("nick '%s' is taken, trying '%s'", msg.Params[1], next)
+	if !registered {
+		c.UpdateNick(next)
+	}
+	c.send(NewMessage("NICK", next))
+}
+
+// selfNickEvent stops waiting for a nick once the server gives us one,
+// and watches for our primary nick if we changed away from it
+func (c *Connection) selfNickEvent(msg *Message, ctx Context) {
+	ev, ok := decodeNick(msg)
+	if !ok || !c.server.EqualFold(ev.User.Nickname, c.CurrentNick()) {
+		return
+	}
+
+	c.nicks.done()
+	c.regain(ev.Nick)
+}
+
+// endOfMotdEvent watches for our primary nick once we've registered without it,
+// for RPL_ENDOFMOTD (376) and ERR_NOMOTD (422), the ISUPPORT is known by then
+func (c *Connection) endOfMotdEvent(msg *Message, ctx Context) {
+	c.regain(c.CurrentNick())
+}
+
+// regain MONITORs our primary nick while we don't have it, if the Configuration
+// asks us to regain it and the server supports MONITOR, otherwise regainLoop uses ISON
+func (c *Connection) regain(nick string) {
+	if !c.conf.RegainNick {
+		return
+	}
+	if _, ok := c.server.Monitor(); !ok {
+		return
+	}
+
+	primary := c.conf.Nickname
+	has := c.server.EqualFold(nick, primary)
+	if !c.nicks.watch(!has) {
+		return
+	}
+
+	if has {
+		c.send(NewMessage("MONITOR", "-", primary))
+	} else {
+		c.send(NewMessage("MONITOR", "+", primary))
+	}
+}
+
+// monOfflineEvent takes our primary nick back when RPL_MONOFFLINE (731) says it's free,
+// '<client> :<nick>[!<user>@<host>][,<nick>...]'
+func (c *Connection) monOfflineEvent(msg *Message, ctx Context) {
+	if !c.conf.RegainNick || len(msg.Params) < 2 {
+		return
+	}
+
+	for _, target := range strings.Split(msg.Params[1], ",") {
+		nick, _, _ := strings.Cut(target, "!")
+		if c.server.EqualFold(nick, c.conf.Nickname) {
+			c.takeNick()
+			return
+		}
+	}
+}
+
+// sentIson notes the nicks asked about when an ISON is written to the server,
+// whoever sent it, so its reply can be matched up
+func (c *Connection) sentIson(line string) {
+	cmd, rest, _ := strings.Cut(line, " ")
+	if strings.EqualFold(cmd, "ISON") {
+		c.nicks.ask(strings.Fields(strings.TrimPrefix(rest, ":")))
+	}
+}
+
+// isonEvent takes our primary nick back when RPL_ISON (303) doesn't list it,
+// if the ISON it answers asked about it, '<client> :[<nick> ...]'
+func (c *Connection) isonEvent(msg *Message, ctx Context) {
+	asked := c.nicks.answered()
+	if !c.conf.RegainNick || len(msg.Params) < 2 || !containsFold(c.server, asked, c.conf.Nickname) {
+		return
+	}
+
+	if containsFold(c.server, strings.Fields(msg.Params[1]), c.conf.Nickname) {
+		return
+	}
+	c.takeNick()
+}
+
+// containsFold returns whether nicks has nick, under the server's CASEMAPPING
+func containsFold(server *ServerInfo, nicks []string, nick string) bool {
+	for _, n := range nicks {
+		if server.EqualFold(n, nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// takeNick asks for our primary nick, if we don't have it,
+// a failure doesn't try any other nicks
+func (c *Connection) takeNick() {
+	if c.server.EqualFold(c.CurrentNick(), c.conf.Nickname) {
+		return
+	}
+
+	log.Infof("regaining nick '%s'", c.conf.Nickname)
+	c.send(NewMessage("NICK", c.conf.Nickname))
+}
+
+// regainLoop sends an ISON for our primary nick every RegainInterval,
+// while we don't have it and the server doesn't support MONITOR
+func (c *Connection) regainLoop() {
+	tick := time.NewTicker(c.conf.RegainInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-tick.C:
+		}
+
+		if !c.isRegistered() || c.server.EqualFold(c.CurrentNick(), c.conf.Nickname) {
+			continue
+		}
+		if _, ok := c.server.Monitor(); ok {
+			continue
+		}
+		c.send(NewMessage("ISON", c.conf.Nickname))
+	}
+}
@@ -0,0 +1,149 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAppendNick(t *testing.T) {
+	Convey("append nick should", t, func() {
+		Convey("append an underscore, then numbers", func() {
+			So(AppendNick("anolis", 1, 9), ShouldEqual, "anolis_")
+			So(AppendNick("anolis", 2, 9), ShouldEqual, "anolis2")
+			So(AppendNick("anolis", 3, 9), ShouldEqual, "anolis3")
+		})
+
+		Convey("shorten the nick to fit", func() {
+			So(AppendNick("anolis", 1, 6), ShouldEqual, "anoli_")
+			So(AppendNick("anolis", 12, 7), ShouldEqual, "anoli12")
+		})
+	})
+}
+
+func TestDial_Nick(t *testing.T) {
+	Convey("a connection should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.FloodInterval = 0
+		conf.AltNicknames = []string{"anolis_alt"}
+
+		Convey("try other nicks when ours is taken while registering", func() {
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			So(client.Expect("NICK"), ShouldEqual, "NICK anolis")
+			client.Send(":irc.localhost 433 * anolis :Nickname is already in use")
+			So(client.Expect("NICK"), ShouldEqual, "NICK anolis_alt")
+			client.Send(":irc.localhost 433 * anolis_alt :Nickname is already in use")
+			So(client.Expect("NICK"), ShouldEqual, "NICK anolis_")
+
+			client.Send(":irc.localhost 001 anolis_ :Welcome")
+			So(eventually(func() bool { return ctx.Connection().CurrentNick() == "anolis_" }), ShouldBeTrue)
+		})
+
+		Convey("not shorten a long nick before the server sends its NICKLEN", func() {
+			conf.Nickname, conf.AltNicknames = "averylongbotnick", nil
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			So(client.Expect("NICK"), ShouldEqual, "NICK averylongbotnick")
+			client.Send(":irc.localhost 433 * averylongbotnick :Nickname is already in use")
+			So(client.Expect("NICK"), ShouldEqual, "NICK averylongbotnick_")
+		})
+
+		Convey("give up registering without a nick generator", func() {
+			conf.AltNicknames, conf.NickGenerator = nil, nil
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+
+			client := srv.Accept()
+			So(client.Expect("NICK"), ShouldEqual, "NICK anolis")
+			client.Send(":irc.localhost 433 * anolis :Nickname is already in use")
+			So(waitForClose(ctx), ShouldResemble, &RegistrationError{"433", "Nickname is already in use"})
+		})
+
+		Convey("try another nick when the one we change to is taken", func() {
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			client.Send(":irc.localhost 001 anolis :Welcome")
+			So(eventually(func() bool { return ctx.Connection().QueueLen() == 0 }), ShouldBeTrue)
+
+			// a channel we can't join isn't a nick
+			client.Send(":irc.localhost 437 anolis #test :Nick/channel is temporarily unavailable")
+			ctx.Commands().Nick("foo")
+			So(client.Expect("NICK"), ShouldEqual, "NICK anolis")
+			So(client.Expect("NICK"), ShouldEqual, "NICK foo")
+
+			client.Send(":irc.localhost 433 anolis foo :Nickname is already in use")
+			So(client.Expect("NICK"), ShouldEqual, "NICK foo_")
+		})
+
+		Convey("regain our nick with ISON", func() {
+			conf.RegainNick, conf.RegainInterval = true, 10*time.Millisecond
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			client.Send(":irc.localhost 001 anolis_alt :Welcome")
+			So(client.Expect("ISON"), ShouldEqual, "ISON anolis")
+
+			client.Send(":irc.localhost 303 anolis_alt :anolis")
+			So(client.Expect("ISON"), ShouldEqual, "ISON anolis")
+
+			client.Send(":irc.localhost 303 anolis_alt :")
+			So(client.Expect("NICK anolis"), ShouldEqual, "NICK anolis")
+		})
+
+		Convey("not regain our nick from someone else's ISON", func() {
+			conf.RegainNick, conf.RegainInterval = true, time.Hour
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			client.Send(":irc.localhost 001 anolis_alt :Welcome")
+			So(eventually(func() bool { return ctx.Connection().CurrentNick() == "anolis_alt" }), ShouldBeTrue)
+
+			ctx.Commands().Raw("ISON someone")
+			So(client.Expect("ISON"), ShouldEqual, "ISON someone")
+			client.Send(":irc.localhost 303 anolis_alt :")
+
+			client.Send("PING :sync")
+			So(client.Expect("PONG"), ShouldEqual, "PONG sync")
+			ctx.Commands().Nick("marker")
+			So(client.Expect("NICK"), ShouldEqual, "NICK marker")
+		})
+
+		Convey("regain our nick with MONITOR", func() {
+			conf.RegainNick = true
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			client.Send(":irc.localhost 001 anolis_alt :Welcome")
+			client.Send(":irc.localhost 005 anolis_alt MONITOR=100 :are supported by this server")
+			client.Send(":irc.localhost 376 anolis_alt :End of /MOTD command.")
+			So(client.Expect("MONITOR"), ShouldEqual, "MONITOR + anolis")
+
+			client.Send(":irc.localhost 731 anolis_alt :anolis")
+			So(client.Expect("NICK anolis"), ShouldEqual, "NICK anolis")
+
+			client.Send(":anolis_alt!bot@i.am.a.bot NICK anolis")
+			So(client.Expect("MONITOR"), ShouldEqual, "MONITOR - anolis")
+			So(eventually(func() bool { return ctx.Connection().CurrentNick() == "anolis" }), ShouldBeTrue)
+		})
+	})
+}
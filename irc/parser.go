@@ -4,28 +4,84 @@ import (
 	"strings"
 )
 
-// ParseMessage takes a raw line and returns a new Message
-func ParseMessage(raw string) *Message {
-	msg := &Message{Raw: raw}
-	// :source command [args] :message
-	if raw[0] == ':' {
-		if i := strings.Index(raw, " "); i >= -1 {
-			msg.Source = NewUser(raw[1:i])
-			raw = raw[i+1 : len(raw)]
+// ParseMessage takes a raw line and returns a new Message,
+// following RFC 1459/2812 with IRCv3 message tags.
+// The error, if any, will be a *ParseError
+func ParseMessage(raw string) (*Message, error) {
+	msg := &Message{Raw: raw, Params: []string{}}
+	line := strings.TrimRight(raw, "\r\n")
+	if line == "" {
+		return nil, &ParseError{raw, "empty message"}
+	}
+
+	// @tags :source command [params] [:trailing]
+	if line[0] == '@' {
+		tags, rest, ok := strings.Cut(line[1:], " ")
+		if !ok {
+			return nil, &ParseError{raw, "tags without a command"}
+		}
+		msg.Tags, line = ParseTags(tags), trimSpaces(rest)
+	}
+
+	if strings.HasPrefix(line, ":") {
+		source, rest, ok := strings.Cut(line[1:], " ")
+		if !ok || source == "" {
+			return nil, &ParseError{raw, "source without a command"}
+		}
+		msg.Source, line = NewUser(source), trimSpaces(rest)
+	}
+
+	command, line, _ := strings.Cut(line, " ")
+	if !validCommand(command) {
+		return nil, &ParseError{raw, "invalid command '" + command + "'"}
+	}
+	msg.Command = strings.ToUpper(command)
+
+	for line = trimSpaces(line); line != ""; line = trimSpaces(line) {
+		if line[0] == ':' {
+			msg.Params, msg.Trailing = append(msg.Params, line[1:]), true
+			break
 		}
+
+		var param string
+		param, line, _ = strings.Cut(line, " ")
+		msg.Params = append(msg.Params, param)
+	}
+
+	// the compatibility views of the params
+	msg.Args = msg.Params
+	if msg.Trailing {
+		n := len(msg.Params) - 1
+		msg.Args, msg.Message = msg.Params[:n:n], msg.Params[n]
 	}
 
-	args := strings.SplitN(raw, " :", 2)
-	if len(args) > 1 {
-		msg.Message = args[1]
+	return msg, nil
+}
+
+// validCommand returns whether s is a command, letters or a 3 digit numeric
+func validCommand(s string) bool {
+	if s == "" {
+		return false
 	}
 
-	args = strings.Split(args[0], " ")
-	msg.Command, msg.Args = strings.ToUpper(args[0]), []string{}
+	if isNumeric(s) {
+		return true
+	}
 
-	if len(args) > 1 {
-		msg.Args = args[1:len(args)]
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
 	}
+	return true
+}
 
-	return msg
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// isNumeric returns whether s is a numeric reply's three digit code
+func isNumeric(s string) bool {
+	return len(s) == 3 && isDigit(s[0]) && isDigit(s[1]) && isDigit(s[2])
 }
+
+// trimSpaces trims leading spaces, servers sometimes send more than one
+func trimSpaces(s string) string { return strings.TrimLeft(s, " ") }
@@ -14,61 +14,154 @@ func TestParseMessage(t *testing.T) {
 			Raw:     ":foo!bar@irc.localhost JOIN #foobar",
 			Source:  src,
 			Command: "JOIN",
+			Params:  []string{"#foobar"},
 			Args:    []string{"#foobar"},
 		},
 		"join": {
-			Raw:     ":foo!bar@irc.localhost JOIN :#foobar",
-			Source:  src,
-			Command: "JOIN",
-			Args:    []string{"#foobar"},
+			Raw:      ":foo!bar@irc.localhost JOIN :#foobar",
+			Source:   src,
+			Command:  "JOIN",
+			Params:   []string{"#foobar"},
+			Trailing: true,
+			Args:     []string{},
+			Message:  "#foobar",
 		},
 		"privmsg": {
-			Raw:     ":foo!bar@irc.localhost PRIVMSG #foobar :hello world",
-			Source:  src,
-			Command: "PRIVMSG",
-			Args:    []string{"#foobar"},
-			Message: "hello world",
+			Raw:      ":foo!bar@irc.localhost PRIVMSG #foobar :hello world",
+			Source:   src,
+			Command:  "PRIVMSG",
+			Params:   []string{"#foobar", "hello world"},
+			Trailing: true,
+			Args:     []string{"#foobar"},
+			Message:  "hello world",
 		},
 		"part": {
-			Raw:     ":foo!bar@irc.localhost PART #foobar :bye",
-			Source:  src,
-			Command: "PART",
-			Args:    []string{"#foobar"},
-			Message: "bye",
+			Raw:      ":foo!bar@irc.localhost PART #foobar :bye",
+			Source:   src,
+			Command:  "PART",
+			Params:   []string{"#foobar", "bye"},
+			Trailing: true,
+			Args:     []string{"#foobar"},
+			Message:  "bye",
 		},
 		"raw": {
-			Raw:     "NOTICE AUTH :*** Checking Ident",
-			Command: "NOTICE",
-			Args:    []string{"AUTH"},
-			Message: "*** Checking Ident",
+			Raw:      "NOTICE AUTH :*** Checking Ident",
+			Command:  "NOTICE",
+			Params:   []string{"AUTH", "*** Checking Ident"},
+			Trailing: true,
+			Args:     []string{"AUTH"},
+			Message:  "*** Checking Ident",
 		},
 		"ping": {
-			Raw:     "PING :1594198849",
-			Command: "PING",
-			Args:    []string{},
-			Message: "1594198849",
+			Raw:      "PING :1594198849",
+			Command:  "PING",
+			Params:   []string{"1594198849"},
+			Trailing: true,
+			Args:     []string{},
+			Message:  "1594198849",
 		},
 		"no text": {
 			Raw:     ":irc.localhost 004 museun irc.localhost beware1.6.2 dgikoswx biklmnoprstv",
 			Source:  NewUser("irc.localhost"),
 			Command: "004",
+			Params:  []string{"museun", "irc.localhost", "beware1.6.2", "dgikoswx", "biklmnoprstv"},
 			Args:    []string{"museun", "irc.localhost", "beware1.6.2", "dgikoswx", "biklmnoprstv"},
 			Message: "",
 		},
+		"tags": {
+			Raw:      "@msgid=abc;+example.com/tag=a\\sb :foo!bar@irc.localhost PRIVMSG #foobar :hello",
+			Tags:     Tags{"msgid": "abc", "+example.com/tag": "a b"},
+			Source:   src,
+			Command:  "PRIVMSG",
+			Params:   []string{"#foobar", "hello"},
+			Trailing: true,
+			Args:     []string{"#foobar"},
+			Message:  "hello",
+		},
 		"many colons": {
-			Raw:     ":foo!bar@irc.localhost PRIVMSG hello :hello world :) for more :colons",
+			Raw:      ":foo!bar@irc.localhost PRIVMSG hello :hello world :) for more :colons",
+			Source:   src,
+			Command:  "PRIVMSG",
+			Params:   []string{"hello", "hello world :) for more :colons"},
+			Trailing: true,
+			Args:     []string{"hello"},
+			Message:  "hello world :) for more :colons",
+		},
+		"empty trailing": {
+			Raw:      ":foo!bar@irc.localhost PRIVMSG #foobar :",
+			Source:   src,
+			Command:  "PRIVMSG",
+			Params:   []string{"#foobar", ""},
+			Trailing: true,
+			Args:     []string{"#foobar"},
+			Message:  "",
+		},
+		"repeated spaces": {
+			Raw:     ":foo!bar@irc.localhost   MODE  #foobar   +b  foo:bar!*@* ",
 			Source:  src,
-			Command: "PRIVMSG",
-			Args:    []string{"hello"},
-			Message: "hello world :) for more :colons",
+			Command: "MODE",
+			Params:  []string{"#foobar", "+b", "foo:bar!*@*"},
+			Args:    []string{"#foobar", "+b", "foo:bar!*@*"},
+		},
+		"lowercase command": {
+			Raw:     "ping irc.localhost",
+			Command: "PING",
+			Params:  []string{"irc.localhost"},
+			Args:    []string{"irc.localhost"},
 		},
 	}
 
 	Convey("Parse Message should", t, func() {
 		for k, v := range tests {
 			Convey(fmt.Sprintf("parse '%s' message", k), func() {
-				So(ParseMessage(v.Raw), ShouldResemble, v)
+				msg, err := ParseMessage(v.Raw)
+				So(err, ShouldBeNil)
+				So(msg, ShouldResemble, v)
 			})
 		}
+
+		invalid := map[string]string{
+			"empty":                  "",
+			"only a crlf":            "\r\n",
+			"tags without command":   "@a=b",
+			"source without command": ":foo!bar@irc.localhost",
+			"empty source":           ": PING",
+			"invalid command":        ":foo!bar@irc.localhost PR1VMSG #foobar :hi",
+			"long numeric":           ":irc.localhost 0001 foo :hi",
+		}
+		for k, v := range invalid {
+			Convey(fmt.Sprintf("reject '%s' message", k), func() {
+				msg, err := ParseMessage(v)
+				So(msg, ShouldBeNil)
+				So(err, ShouldHaveSameTypeAs, &ParseError{})
+			})
+		}
+	})
+}
+
+func FuzzParseMessage(f *testing.F) {
+	for _, seed := range []string{
+		":foo!bar@irc.localhost PRIVMSG #foobar :hello world",
+		"@a=b\\:c;+d :irc.localhost 005 anolis CHANTYPES=# :are supported",
+		"PING :1594198849",
+		"@",
+		":",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		msg, err := ParseMessage(raw)
+		if err != nil {
+			return
+		}
+
+		if msg.Command == "" {
+			t.Fatalf("parsed %q without a command", raw)
+		}
+		if n := len(msg.Args); msg.Trailing && n != len(msg.Params)-1 || !msg.Trailing && n != len(msg.Params) {
+			t.Fatalf("parsed %q with %d args from %d params", raw, n, len(msg.Params))
+		}
 	})
 }
@@ -0,0 +1,159 @@
+package irc
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// sendQueue holds the lines waiting to be written to the server.
+// Lines in the normal lane are limited by a token bucket, which allows a burst
+// of lines and then one line per interval, like the RFC 1459 penalty timer.
+// Lines in the urgent lane skip the bucket.
+type sendQueue struct {
+	urgent, normal []string
+	wake           chan struct{}
+	drain          []chan struct{} // closed once the lanes are empty
+
+	burst    int
+	interval time.Duration
+	tokens   int
+	refilled time.Time
+
+	sync.Mutex
+}
+
+func newSendQueue(burst int, interval time.Duration) *sendQueue {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &sendQueue{
+		wake:     make(chan struct{}, 1),
+		burst:    burst,
+		interval: interval,
+		tokens:   burst,
+		refilled: time.Now(),
+	}
+}
+
+// Len returns how many lines are waiting
+func (q *sendQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.urgent) + len(q.normal)
+}
+
+// push adds the line to the end of its lane
+func (q *sendQueue) push(line string, urgent bool) {
+	q.Lock()
+	if urgent {
+		q.urgent = append(q.urgent, line)
+	} else {
+		q.normal = append(q.normal, line)
+	}
+	q.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// clear drops the lines waiting in both lanes
+func (q *sendQueue) clear() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.urgent, q.normal = nil, nil
+	q.drained()
+}
+
+// empty returns a channel that's closed once no lines are waiting
+func (q *sendQueue) empty() <-chan struct{} {
+	q.Lock()
+	defer q.Unlock()
+
+	ch := make(chan struct{})
+	q.drain = append(q.drain, ch)
+	q.drained()
+	return ch
+}
+
+// drained closes the empty channels if no lines are waiting, the lock must be held
+func (q *sendQueue) drained() {
+	if len(q.urgent)+len(q.normal) > 0 {
+		return
+	}
+
+	for _, ch := range q.drain {
+		close(ch)
+	}
+	q.drain = nil
+}
+
+// next blocks until a line can be sent, or done is closed
+func (q *sendQueue) next(done <-chan struct{}) (string, bool) {
+	for {
+		q.Lock()
+		if len(q.urgent) > 0 {
+			line := q.urgent[0]
+			q.urgent = q.urgent[1:]
+			q.drained()
+			q.Unlock()
+			return line, true
+		}
+
+		var wait <-chan time.Time
+		if len(q.normal) > 0 {
+			if q.take(time.Now()) {
+				line := q.normal[0]
+				q.normal = q.normal[1:]
+				q.drained()
+				q.Unlock()
+				return line, true
+			}
+			wait = time.After(q.interval - time.Since(q.refilled))
+		}
+		q.Unlock()
+
+		select {
+		case <-q.wake:
+		case <-wait:
+		case <-done:
+			return "", false
+		}
+	}
+}
+
+// take refills the bucket and takes a token from it, if there is one
+func (q *sendQueue) take(now time.Time) bool {
+	if q.interval <= 0 {
+		return true
+	}
+
+	if n := int(now.Sub(q.refilled) / q.interval); n > 0 {
+		q.tokens += n
+		q.refilled = q.refilled.Add(time.Duration(n) * q.interval)
+		if q.tokens >= q.burst {
+			q.tokens, q.refilled = q.burst, now
+		}
+	}
+
+	if q.tokens == 0 {
+		return false
+	}
+	q.tokens--
+	return true
+}
+
+// urgentLine returns whether the line should skip the flood control
+func urgentLine(line string) bool {
+	cmd, _, _ := strings.Cut(line, " ")
+	switch strings.ToUpper(cmd) {
+	case "PONG", "QUIT":
+		return true
+	}
+	return false
+}
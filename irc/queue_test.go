@@ -0,0 +1,82 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSendQueue(t *testing.T) {
+	Convey("send queue should", t, func() {
+		done := make(chan struct{})
+		defer close(done)
+
+		q := newSendQueue(2, 50*time.Millisecond)
+		for _, line := range []string{"PRIVMSG #a 1", "PRIVMSG #a 2", "PRIVMSG #a 3"} {
+			q.push(line, urgentLine(line))
+		}
+		So(q.Len(), ShouldEqual, 3)
+
+		Convey("send a burst, then wait for the bucket to refill", func() {
+			start := time.Now()
+			for _, want := range []string{"PRIVMSG #a 1", "PRIVMSG #a 2"} {
+				line, ok := q.next(done)
+				So(ok, ShouldBeTrue)
+				So(line, ShouldEqual, want)
+			}
+			So(time.Since(start), ShouldBeLessThan, 25*time.Millisecond)
+
+			line, _ := q.next(done)
+			So(line, ShouldEqual, "PRIVMSG #a 3")
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+			So(q.Len(), ShouldEqual, 0)
+		})
+
+		Convey("let urgent lines skip the queue", func() {
+			q.next(done)
+			q.next(done)
+			q.push("PONG :irc.localhost", urgentLine("PONG :irc.localhost"))
+
+			start := time.Now()
+			line, _ := q.next(done)
+			So(line, ShouldEqual, "PONG :irc.localhost")
+			So(time.Since(start), ShouldBeLessThan, 25*time.Millisecond)
+		})
+
+		Convey("drop the lines in both lanes when cleared", func() {
+			q.push("PONG :irc.localhost", true)
+			q.clear()
+			So(q.Len(), ShouldEqual, 0)
+		})
+
+		Convey("signal once it's empty", func() {
+			closed := func(ch <-chan struct{}) bool {
+				select {
+				case <-ch:
+					return true
+				default:
+					return false
+				}
+			}
+
+			empty := q.empty()
+			q.next(done)
+			q.next(done)
+			So(closed(empty), ShouldBeFalse)
+
+			q.next(done)
+			So(closed(empty), ShouldBeTrue)
+			So(closed(q.empty()), ShouldBeTrue)
+		})
+
+		Convey("stop waiting when the connection closes", func() {
+			q.clear()
+			closed := make(chan struct{})
+			close(closed)
+
+			_, ok := q.next(closed)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package irc
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ReconnectPolicy describes how a dropped connection is redialed
+type ReconnectPolicy struct {
+	// MaxAttempts is how many redials to try before giving up, 0 never gives up
+	MaxAttempts int
+
+	// MinDelay is the delay before the first attempt, it is multiplied by
+	// Multiplier for every attempt after that, up to MaxDelay
+	MinDelay, MaxDelay time.Duration
+	Multiplier         float64
+
+	// Jitter randomizes each delay by up to this fraction of it
+	Jitter float64
+}
+
+// NewReconnectPolicy returns a new, default reconnect policy
+func NewReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		MaxAttempts: 10,
+		MinDelay:    2 * time.Second,
+		MaxDelay:    5 * time.Minute,
+		Multiplier:  2,
+		Jitter:      0.2,
+	}
+}
+
+// Delay returns how long to wait before the attempt'th redial, starting at 1
+func (p *ReconnectPolicy) Delay(attempt int) time.Duration {
+	mul := p.Multiplier
+	if mul < 1 {
+		mul = 1
+	}
+
+	d := float64(p.MinDelay) * math.Pow(mul, float64(attempt-1))
+	if max := float64(p.MaxDelay); max > 0 && d > max {
+		d = max
+	}
+
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// reconnect redials the server after err dropped the connection,
+// it returns the close reason if the connection should stay closed
+func (c *Connection) reconnect(err error) error {
+	if c.conf.Reconnect == nil {
+		return err
+	}
+
+	// keep any channels we didn't get to rejoin last time
+	c.Lock()
+	for _, name := range c.ch.GetNames() {
+		join := NewMessage("JOIN", name)
+		if ch, ok := c.ch.Get(name); ok && ch.Key() != "" {
+			join.Params = append(join.Params, ch.Key())
+		}
+		c.rejoin = append(c.rejoin, join)
+	}
+	c.endSession()
+	c.Unlock()
+	c.ch.clear()
+	c.queue.clear()
+
+	disconnected := NewMessage(Disconnected, err.Error())
+	disconnected.Message = err.Error()
+	c.dispatch(disconnected)
+
+	policy := c.conf.Reconnect
+	for {
+		c.Lock()
+		c.attempts++
+		attempt := c.attempts
+		c.Unlock()
+
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			return &ReconnectError{policy.MaxAttempts, err}
+		}
+
+		delay := policy.Delay(attempt)
+		log.Infof("reconnecting to %s in %s (attempt %d)", c.address, delay, attempt)
+		select {
+		case <-c.done:
+			return ErrClosed
+		case <-time.After(delay):
+		}
+
+		if err = c.connect(c.ctx); err != nil {
+			log.Warnf("reconnecting failed: %s", err)
+			continue
+		}
+
+		c.Lock()
+		c.session, c.endSession = context.WithCancel(c.ctx)
+		c.Unlock()
+
+		c.dispatch(&Message{Command: Reconnected})
+		return nil
+	}
+}
@@ -0,0 +1,131 @@
+package irc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReconnectPolicy(t *testing.T) {
+	p := &ReconnectPolicy{
+		MinDelay:   time.Second,
+		MaxDelay:   10 * time.Second,
+		Multiplier: 2,
+	}
+
+	Convey("reconnect policy should", t, func() {
+		Convey("back off exponentially", func() {
+			So(p.Delay(1), ShouldEqual, time.Second)
+			So(p.Delay(2), ShouldEqual, 2*time.Second)
+			So(p.Delay(3), ShouldEqual, 4*time.Second)
+		})
+
+		Convey("not go past the max delay", func() {
+			So(p.Delay(10), ShouldEqual, 10*time.Second)
+		})
+
+		Convey("add jitter", func() {
+			p.Jitter = 0.5
+			for i := 0; i < 10; i++ {
+				So(p.Delay(2), ShouldBeBetweenOrEqual, time.Second, 3*time.Second)
+			}
+		})
+	})
+}
+
+func TestReconnect(t *testing.T) {
+	Convey("a connection with a reconnect policy should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.Reconnect = &ReconnectPolicy{MaxAttempts: 2, MinDelay: time.Millisecond}
+
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		session := ctx.Context()
+		events := make(chan string, 4)
+		ctx.Events().Add(Disconnected, func(msg *Message, ctx Context) { events <- msg.Command })
+		ctx.Events().Add(Reconnected, func(msg *Message, ctx Context) { events <- msg.Command })
+
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+		client.Send(":anolis!bot@i.am.a.bot JOIN #test")
+		So(eventually(func() bool { return ctx.Channels().Has("#test") }), ShouldBeTrue)
+		client.Close()
+
+		Convey("redial and rejoin its channels", func() {
+			client = srv.Accept()
+			So(client.Expect("NICK"), ShouldEqual, "NICK anolis")
+			So(client.Expect("USER"), ShouldEqual, "USER anolis 0 * :anolis")
+
+			client.Send(":irc.localhost 001 anolis :Welcome")
+			So(client.Expect("JOIN"), ShouldEqual, "JOIN #test")
+			So(<-events, ShouldEqual, Disconnected)
+			So(<-events, ShouldEqual, Reconnected)
+		})
+
+		Convey("cancel the events' context when it drops, and start a new one", func() {
+			So(<-events, ShouldEqual, Disconnected)
+			So(session.Err(), ShouldEqual, context.Canceled)
+
+			client = srv.Accept()
+			client.Send(":irc.localhost 001 anolis :Welcome")
+			So(<-events, ShouldEqual, Reconnected)
+			So(ctx.Context(), ShouldNotEqual, session)
+			So(ctx.Context().Err(), ShouldBeNil)
+		})
+
+		Convey("give up after too many attempts", func() {
+			srv.Close()
+			err := waitForClose(ctx)
+			So(err, ShouldHaveSameTypeAs, &ReconnectError{})
+			So(err.(*ReconnectError).Attempts, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestReconnect_Rejoin(t *testing.T) {
+	Convey("a connection that reconnects should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.FloodInterval = 0
+		conf.Reconnect = &ReconnectPolicy{MaxAttempts: 2, MinDelay: time.Millisecond}
+
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		disconnected := make(chan *Message, 1)
+		ctx.Events().Add(Disconnected, func(msg *Message, ctx Context) { disconnected <- msg })
+
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+		client.Send(":anolis!bot@i.am.a.bot JOIN #keyed")
+		client.Send(":irc.localhost 324 anolis #keyed +kn secret")
+		So(eventually(func() bool {
+			ch, ok := ctx.Channels().Get("#keyed")
+			return ok && ch.Key() == "secret"
+		}), ShouldBeTrue)
+		client.Close()
+
+		Convey("give the reason in the Disconnected params", func() {
+			msg := <-disconnected
+			So(msg.Params, ShouldHaveLength, 1)
+			So(msg.Params[0], ShouldEqual, msg.Message)
+			So(msg.Message, ShouldStartWith, "irc: reading from server")
+		})
+
+		Convey("rejoin its channels with their keys", func() {
+			client = srv.Accept()
+			client.Send(":irc.localhost 001 anolis :Welcome")
+			So(client.Expect("JOIN"), ShouldEqual, "JOIN #keyed secret")
+		})
+	})
+}
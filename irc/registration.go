@@ -0,0 +1,108 @@
+package irc
+
+// register sends our registration, and starts capability negotiation
+func (c *Connection) register() {
+	c.caps.reset()
+	c.Raw("CAP LS 302")
+
+	if c.conf.Password != "" {
+		c.rawSecret("PASS %s", c.conf.Password)
+	}
+
+	c.nicks.reset()
+	c.nicks.want(c.conf.Nickname, c.conf.AltNicknames)
+	c.Raw("NICK %s", c.conf.Nickname)
+	c.Raw("USER %s 0 * :%s", c.conf.Username, c.conf.Realname)
+}
+
+// protocolEvents returns the events the Connection handles itself,
+// they are dispatched in order as each line is read
+func (c *Connection) protocolEvents() *Events {
+	ev := newEvents()
+
+	ev.Add("001", c.welcomeEvent)         // RPL_WELCOME
+	ev.Add("001", c.server.welcomeEvent)  // RPL_WELCOME
+	ev.Add("004", c.server.myInfoEvent)   // RPL_MYINFO
+	ev.Add("005", c.server.isupportEvent) // RPL_ISUPPORT
+	ev.Add("464", c.refusedEvent)         // ERR_PASSWDMISMATCH
+	ev.Add("465", c.refusedEvent)         // ERR_YOUREBANNEDCREEP
+	ev.Add("ERROR", c.errorEvent)
+	ev.Add("CAP", c.capEvent)
+	ev.Add("PONG", c.pongEvent)
+
+	ev.Add("433", c.nickTakenEvent) // ERR_NICKNAMEINUSE
+	ev.Add("436", c.nickTakenEvent) // ERR_NICKCOLLISION
+	ev.Add("437", c.nickTakenEvent) // ERR_UNAVAILRESOURCE
+	ev.Add("NICK", c.selfNickEvent)
+	ev.Add("376", c.endOfMotdEvent)  // RPL_ENDOFMOTD
+	ev.Add("422", c.endOfMotdEvent)  // ERR_NOMOTD
+	ev.Add("303", c.isonEvent)       // RPL_ISON
+	ev.Add("731", c.monOfflineEvent) // RPL_MONOFFLINE
+
+	ev.Add("JOIN", c.selfEvent)
+	ev.Add("JOIN", c.autoWhoEvent)
+	ev.Add("JOIN", c.modeQueryEvent)
+	ev.Add("JOIN", c.listQueryEvent)
+	ev.Add("CHGHOST", c.chghostEvent)
+	ev.Add("396", c.visibleHostEvent) // RPL_VISIBLEHOST
+
+	ev.Add("AUTHENTICATE", c.authenticateEvent)
+	ev.Add("900", c.loggedInEvent)  // RPL_LOGGEDIN
+	ev.Add("903", c.saslDoneEvent)  // RPL_SASLSUCCESS
+	ev.Add("907", c.saslDoneEvent)  // ERR_SASLALREADY
+	ev.Add("902", c.saslFailEvent)  // ERR_NICKLOCKED
+	ev.Add("904", c.saslFailEvent)  // ERR_SASLFAIL
+	ev.Add("905", c.saslFailEvent)  // ERR_SASLTOOLONG
+	ev.Add("906", c.saslFailEvent)  // ERR_SASLABORTED
+	ev.Add("908", c.saslMechsEvent) // RPL_SASLMECHS
+
+	return ev
+}
+
+// welcomeEvent marks us as registered, and rejoins our channels after a reconnect
+func (c *Connection) welcomeEvent(msg *Message, ctx Context) {
+	c.Lock()
+	c.registered, c.attempts = true, 0
+	c.nicks.done()
+	if len(msg.Params) > 0 {
+		// the server tells us the nick we registered with
+		c.nickname = msg.Params[0]
+	}
+	rejoin, authed := c.rejoin, c.authed
+	c.rejoin = nil
+	c.Unlock()
+
+	// the server never let us try
+	if c.conf.SASLRequired && !authed {
+		c.closeWith(&SASLError{msg.Command, "registered without authenticating"})
+		return
+	}
+
+	for _, join := range rejoin {
+		c.send(join)
+	}
+}
+
+// refusedEvent remembers why the server refused our registration
+func (c *Connection) refusedEvent(msg *Message, ctx Context) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.reason == nil {
+		c.reason = &RegistrationError{msg.Command, msg.Message}
+	}
+}
+
+// errorEvent remembers why the server is closing the connection
+func (c *Connection) errorEvent(msg *Message, ctx Context) {
+	c.Lock()
+	defer c.Unlock()
+
+	switch {
+	case c.reason != nil:
+	case c.registered:
+		c.reason = &ServerError{msg.Message}
+	default:
+		c.reason = &RegistrationError{msg.Command, msg.Message}
+	}
+}
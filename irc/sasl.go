@@ -0,0 +1,108 @@
+package irc
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// saslChunk is the most AUTHENTICATE can carry in one message
+const saslChunk = 400
+
+// finishCaps authenticates with SASL if it was configured,
+// otherwise it ends the negotiation
+func (c *Connection) finishCaps() {
+	mech := strings.ToUpper(c.conf.SASLMechanism)
+	if mech == "" || c.isRegistered() {
+		c.endCaps()
+		return
+	}
+
+	if !c.caps.Enabled("sasl") {
+		c.saslFailed(&SASLError{"CAP", "server doesn't offer sasl"})
+		return
+	}
+
+	// cap-notify 302 lists the mechanisms the server supports
+	if mechs, _ := c.caps.Available("sasl"); mechs != "" && !hasToken(mechs, ",", mech) {
+		c.saslFailed(&SASLError{"CAP", "server doesn't support " + mech + ", only " + mechs})
+		return
+	}
+
+	log.Debugf("authenticating with %s", mech)
+	c.Raw("AUTHENTICATE %s", mech)
+}
+
+// authenticateEvent sends our credentials when the server is ready for them
+func (c *Connection) authenticateEvent(msg *Message, ctx Context) {
+	if len(msg.Params) == 0 || msg.Params[0] != "+" {
+		return
+	}
+
+	var payload string
+	if strings.ToUpper(c.conf.SASLMechanism) == "PLAIN" {
+		user := c.conf.SASLUsername
+		payload = base64.StdEncoding.EncodeToString(
+			[]byte(user + "\x00" + user + "\x00" + c.conf.SASLPassword),
+		)
+	}
+
+	// the payload is sent in chunks, and ends with '+' if the last one was full
+	for len(payload) >= saslChunk {
+		c.rawSecret("AUTHENTICATE %s", payload[:saslChunk])
+		payload = payload[saslChunk:]
+	}
+	if payload == "" {
+		payload = "+"
+	}
+	c.rawSecret("AUTHENTICATE %s", payload)
+}
+
+// loggedInEvent logs the account we are logged in as
+func (c *Connection) loggedInEvent(msg *Message, ctx Context) {
+	if len(msg.Params) > 2 {
+		log.Infof("logged in as %s", msg.Params[2])
+	}
+}
+
+// saslDoneEvent ends the negotiation once we are authenticated
+func (c *Connection) saslDoneEvent(msg *Message, ctx Context) {
+	c.Lock()
+	c.authed = true
+	c.Unlock()
+
+	c.endCaps()
+}
+
+// saslFailEvent handles the ways authentication can fail
+func (c *Connection) saslFailEvent(msg *Message, ctx Context) {
+	c.saslFailed(&SASLError{msg.Command, msg.Message})
+}
+
+// saslMechsEvent logs the mechanisms the server supports, a failure follows it
+func (c *Connection) saslMechsEvent(msg *Message, ctx Context) {
+	if len(msg.Params) > 1 {
+		log.Warnf("server only supports sasl mechanisms: %s", msg.Params[1])
+	}
+}
+
+// saslFailed closes the connection if SASL was required,
+// otherwise it carries on registering without it
+func (c *Connection) saslFailed(err *SASLError) {
+	if c.conf.SASLRequired {
+		c.closeWith(err)
+		return
+	}
+
+	log.Warnf("%s", err)
+	c.endCaps()
+}
+
+// hasToken returns whether s, split by sep, contains tok
+func hasToken(s, sep, tok string) bool {
+	for _, t := range strings.Split(s, sep) {
+		if strings.EqualFold(t, tok) {
+			return true
+		}
+	}
+	return false
+}
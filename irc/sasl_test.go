@@ -0,0 +1,104 @@
+package irc
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSASL(t *testing.T) {
+	Convey("sasl should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.SASLMechanism = "PLAIN"
+		conf.SASLUsername, conf.SASLPassword = "anolis", "hunter2"
+
+		dial := func() (Context, *testClient) {
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+
+			client := srv.Accept()
+			client.Send(":irc.localhost CAP * LS :sasl=PLAIN,EXTERNAL")
+			return ctx, client
+		}
+
+		Convey("authenticate with PLAIN", func() {
+			ctx, client := dial()
+			defer ctx.Connection().Close()
+
+			So(client.Expect("CAP REQ"), ShouldEqual, "CAP REQ :sasl")
+			client.Send(":irc.localhost CAP * ACK :sasl")
+			So(client.Expect("AUTHENTICATE"), ShouldEqual, "AUTHENTICATE PLAIN")
+
+			client.Send("AUTHENTICATE +")
+			payload := base64.StdEncoding.EncodeToString([]byte("anolis\x00anolis\x00hunter2"))
+			So(client.Expect("AUTHENTICATE"), ShouldEqual, "AUTHENTICATE "+payload)
+
+			client.Send(":irc.localhost 903 * :SASL authentication successful")
+			So(client.Expect("CAP"), ShouldEqual, "CAP END")
+		})
+
+		Convey("split long payloads into chunks", func() {
+			// 300 bytes encodes to exactly 400
+			conf.SASLUsername, conf.SASLPassword = "anolis", strings.Repeat("a", 300-14)
+			ctx, client := dial()
+			defer ctx.Connection().Close()
+
+			client.Expect("CAP REQ")
+			client.Send(":irc.localhost CAP * ACK :sasl")
+			client.Expect("AUTHENTICATE")
+			client.Send("AUTHENTICATE +")
+
+			So(len(client.Expect("AUTHENTICATE")), ShouldEqual, len("AUTHENTICATE ")+400)
+			So(client.Expect("AUTHENTICATE"), ShouldEqual, "AUTHENTICATE +")
+		})
+
+		Convey("authenticate with EXTERNAL", func() {
+			conf.SASLMechanism = "external"
+			ctx, client := dial()
+			defer ctx.Connection().Close()
+
+			client.Expect("CAP REQ")
+			client.Send(":irc.localhost CAP * ACK :sasl")
+			So(client.Expect("AUTHENTICATE"), ShouldEqual, "AUTHENTICATE EXTERNAL")
+
+			client.Send("AUTHENTICATE +")
+			So(client.Expect("AUTHENTICATE"), ShouldEqual, "AUTHENTICATE +")
+		})
+
+		Convey("carry on registering when it fails", func() {
+			ctx, client := dial()
+			defer ctx.Connection().Close()
+
+			client.Expect("CAP REQ")
+			client.Send(":irc.localhost CAP * ACK :sasl")
+			client.Send("AUTHENTICATE +")
+			client.Send(":irc.localhost 904 * :SASL authentication failed")
+			So(client.Expect("CAP"), ShouldEqual, "CAP END")
+		})
+
+		Convey("close the connection when it fails and is required", func() {
+			conf.SASLRequired = true
+			ctx, client := dial()
+
+			client.Expect("CAP REQ")
+			client.Send(":irc.localhost CAP * ACK :sasl")
+			client.Send("AUTHENTICATE +")
+			client.Send(":irc.localhost 904 * :SASL authentication failed")
+			So(waitForClose(ctx), ShouldResemble, &SASLError{"904", "SASL authentication failed"})
+		})
+
+		Convey("close the connection when the server doesn't support the mechanism", func() {
+			conf.SASLMechanism, conf.SASLRequired = "SCRAM-SHA-256", true
+			ctx, client := dial()
+
+			client.Expect("CAP REQ")
+			client.Send(":irc.localhost CAP * ACK :sasl")
+			So(waitForClose(ctx), ShouldHaveSameTypeAs, &SASLError{})
+		})
+	})
+}
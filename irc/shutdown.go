@@ -0,0 +1,39 @@
+package irc
+
+import "context"
+
+// Shutdown quits gracefully: it waits for the queued lines to be sent, sends QUIT
+// with reason, and waits for the server to close the link. If ctx is done first
+// the connection is closed anyway, and ctx's error is returned. While the connection
+// is waiting to reconnect nothing can be sent, so it is closed right away.
+// Either way the connection closes with ErrQuit
+func (c *Connection) Shutdown(ctx context.Context, reason string) error {
+	if !c.isConnected() {
+		c.closeWith(ErrQuit)
+		return nil
+	}
+
+	select {
+	case <-c.queue.empty():
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		c.closeWith(ErrQuit)
+		return ctx.Err()
+	}
+
+	// the link may have dropped while the queue drained
+	if !c.isConnected() {
+		c.closeWith(ErrQuit)
+		return nil
+	}
+
+	c.Quit(reason)
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		c.closeWith(ErrQuit)
+		return ctx.Err()
+	}
+}
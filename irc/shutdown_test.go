@@ -0,0 +1,88 @@
+package irc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShutdown(t *testing.T) {
+	Convey("shutdown should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.FloodBurst, conf.FloodInterval = 1, 20*time.Millisecond
+		conf.Reconnect = &ReconnectPolicy{MaxAttempts: 2, MinDelay: time.Millisecond}
+
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+		So(client.Expect("NICK"), ShouldEqual, "NICK anolis")
+
+		Convey("send the queued lines before quitting", func() {
+			So(eventually(func() bool { return ctx.Connection().QueueLen() == 0 }), ShouldBeTrue)
+			for _, s := range []string{"a", "b", "c"} {
+				ctx.Commands().Privmsg("#test", s)
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- ctx.Connection().Shutdown(context.Background(), "bye") }()
+
+			So(client.Expect("PRIVMSG"), ShouldEqual, "PRIVMSG #test a")
+			So(client.Expect("PRIVMSG"), ShouldEqual, "PRIVMSG #test b")
+			So(client.Expect("PRIVMSG"), ShouldEqual, "PRIVMSG #test c")
+			So(client.Expect("QUIT"), ShouldEqual, "QUIT bye")
+
+			client.Send("ERROR :Closing link: (anolis@localhost) [Quit: bye]")
+			client.Close()
+
+			So(<-done, ShouldBeNil)
+			So(waitForClose(ctx), ShouldEqual, ErrQuit)
+		})
+
+		Convey("close when the server doesn't hang up in time", func() {
+			timeout, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			So(ctx.Connection().Shutdown(timeout, "bye"), ShouldEqual, context.DeadlineExceeded)
+			So(client.Expect("QUIT"), ShouldEqual, "QUIT bye")
+			So(waitForClose(ctx), ShouldEqual, ErrQuit)
+		})
+
+		Convey("close right away while waiting to reconnect", func() {
+			conf := srv.Configuration()
+			conf.Reconnect = &ReconnectPolicy{MinDelay: time.Hour}
+			ctx, err := Dial(conf)
+			So(err, ShouldBeNil)
+			defer ctx.Connection().Close()
+
+			client := srv.Accept()
+			client.Send(":irc.localhost 001 anolis :Welcome")
+			So(eventually(func() bool { return ctx.Connection().(*Connection).isRegistered() }), ShouldBeTrue)
+			client.Close()
+			So(eventually(func() bool { return !ctx.Connection().(*Connection).isConnected() }), ShouldBeTrue)
+
+			timeout, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			start := time.Now()
+			So(ctx.Connection().Shutdown(timeout, "bye"), ShouldBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			So(waitForClose(ctx), ShouldEqual, ErrQuit)
+		})
+
+		Convey("not reconnect after quitting", func() {
+			ctx.Commands().Quit("bye")
+			So(client.Expect("QUIT"), ShouldEqual, "QUIT bye")
+			client.Close()
+
+			So(waitForClose(ctx), ShouldEqual, ErrQuit)
+		})
+	})
+}
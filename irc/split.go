@@ -0,0 +1,275 @@
+package irc
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// the longest user and host the server might relay our messages with,
+// for when we haven't seen our own mask yet, and it didn't send USERLEN or HOSTLEN
+const (
+	maxUserLength = 10
+	maxHostLength = 63
+)
+
+// mIRC formatting codes
+const (
+	fmtBold      = '\x02'
+	fmtColor     = '\x03'
+	fmtHexColor  = '\x04'
+	fmtReset     = '\x0f'
+	fmtMonospace = '\x11'
+	fmtReverse   = '\x16'
+	fmtItalic    = '\x1d'
+	fmtStrike    = '\x1e'
+	fmtUnderline = '\x1f'
+)
+
+// toggleCodes are the formatting codes that turn something on, then off
+var toggleCodes = []byte{fmtBold, fmtItalic, fmtUnderline, fmtStrike, fmtMonospace, fmtReverse}
+
+// formatState is the formatting active at some point in a line
+type formatState struct {
+	toggles      uint8  // bits for each of toggleCodes
+	fg, bg       string // two digit colors
+	hexFg, hexBg string // six digit hex colors
+}
+
+// apply updates the state with the formatting code
+func (f *formatState) apply(code string) {
+	switch code[0] {
+	case fmtReset:
+		*f = formatState{}
+	case fmtColor:
+		f.fg, f.bg = parseColor(code[1:], 2)
+	case fmtHexColor:
+		f.hexFg, f.hexBg = parseColor(code[1:], 6)
+	default:
+		f.toggles ^= 1 << strings.IndexByte(string(toggleCodes), code[0])
+	}
+}
+
+// codes returns the formatting codes that start a line in this state
+func (f formatState) codes() string {
+	var buf strings.Builder
+	for i, c := range toggleCodes {
+		if f.toggles&(1<<i) != 0 {
+			buf.WriteByte(c)
+		}
+	}
+
+	if f.fg != "" {
+		buf.WriteString(string(fmtColor) + f.fg)
+		if f.bg != "" {
+			buf.WriteString("," + f.bg)
+		}
+	}
+	if f.hexFg != "" {
+		buf.WriteString(string(fmtHexColor) + f.hexFg)
+		if f.hexBg != "" {
+			buf.WriteString("," + f.hexBg)
+		}
+	}
+	return buf.String()
+}
+
+// parseColor parses 'fg[,bg]' after a color code, padding them to width
+func parseColor(s string, width int) (fg, bg string) {
+	fg, rest := s, ""
+	if i := strings.IndexByte(s, ','); i > -1 {
+		fg, rest = s[:i], s[i+1:]
+	}
+
+	pad := func(s string) string {
+		if s == "" {
+			return s
+		}
+		return strings.Repeat("0", width-len(s)) + s
+	}
+	return pad(fg), pad(rest)
+}
+
+// formatCode returns the length of the formatting code at the start of s, or 0
+func formatCode(s string) int {
+	switch s[0] {
+	case fmtBold, fmtReset, fmtMonospace, fmtReverse, fmtItalic, fmtStrike, fmtUnderline:
+		return 1
+	case fmtColor:
+		return colorCode(s, isDigit, 2)
+	case fmtHexColor:
+		return colorCode(s, isHexDigit, 6)
+	}
+	return 0
+}
+
+// colorCode returns the length of the color code at the start of s, up to
+// width digits for the foreground and then ',' and width digits for the background
+func colorCode(s string, digit func(byte) bool, width int) int {
+	digits := func(i int) int {
+		n := 0
+		for n < width && i+n < len(s) && digit(s[i+n]) {
+			n++
+		}
+		return n
+	}
+
+	n := 1
+	fg := digits(n)
+	if fg == 0 {
+		return n
+	}
+	n += fg
+
+	if n+1 < len(s) && s[n] == ',' {
+		if bg := digits(n + 1); bg > 0 {
+			n += 1 + bg
+		}
+	}
+	return n
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || 'a' <= c|0x20 && c|0x20 <= 'f'
+}
+
+// splitText splits text into lines of at most max bytes. It splits on spaces
+// where it can, never inside a rune or a formatting code, and starts every
+// line after the first with the formatting that was active where it split
+func splitText(text string, max int) []string {
+	if len(text) <= max {
+		return []string{text}
+	}
+
+	var units []string // runes and formatting codes
+	for s := text; s != ""; {
+		n := formatCode(s)
+		if n == 0 {
+			_, n = utf8.DecodeRuneInString(s)
+		}
+		units, s = append(units, s[:n]), s[n:]
+	}
+
+	var (
+		lines []string
+		state formatState
+	)
+	for i := 0; i < len(units); {
+		line, st := state.codes(), state
+
+		// the last space we could split on
+		brk, brkLen, brkState := -1, 0, st
+
+		j := i
+		for ; j < len(units) && len(line)+len(units[j]) <= max; j++ {
+			line += units[j]
+			if formatCode(units[j]) > 0 {
+				st.apply(units[j])
+			}
+			if units[j] == " " {
+				brk, brkLen, brkState = j+1, len(line), st
+			}
+		}
+
+		switch {
+		case j == i: // not even one unit fits, send it anyway
+			line += units[j]
+			j++
+		case j < len(units) && brk > i:
+			line, j, st = line[:brkLen], brk, brkState
+		}
+
+		if trimmed := strings.TrimRight(line, " "); trimmed != "" {
+			lines = append(lines, trimmed)
+		}
+		i, state = j, st
+
+		// the next line shouldn't start with the spaces we split on
+		for i < len(units) && units[i] == " " {
+			i++
+		}
+	}
+	return lines
+}
+
+// textBudget returns how many bytes of text fit in a cmd to target
+// once the server relays it with our mask
+func (c *Connection) textBudget(cmd, target string) int {
+	c.RLock()
+	nick, user, host := c.nickname, c.username, c.hostname
+	c.RUnlock()
+
+	n := len(nick)
+	if user != "" && host != "" {
+		n += len("!"+user) + len("@"+host)
+	} else {
+		n += 1 + c.server.num("USERLEN", maxUserLength) + 1 + c.server.num("HOSTLEN", maxHostLength)
+	}
+
+	// ':mask CMD target :text\r\n', the ':', three spaces, the ':' and the CRLF
+	return c.server.LineLen() - len(":   :\r\n") - n - len(cmd) - len(target)
+}
+
+// sendText sends text to target with cmd, split over as many lines as it needs.
+// A CTCP, e.g. an ACTION, has only its body split, each line keeps the CTCP framing
+func (c *Connection) sendText(cmd, target, text string) {
+	text = stripInvalid(text)
+	prefix, body, suffix := splitCTCP(text)
+	for _, line := range splitText(body, c.textBudget(cmd, target)-len(prefix)-len(suffix)) {
+		c.send(NewMessage(cmd, target, prefix+line+suffix))
+	}
+}
+
+// splitCTCP splits a CTCP's framing, e.g. "\x01ACTION " and "\x01", off its body.
+// Text that isn't a CTCP with a body is returned whole as the body
+func splitCTCP(text string) (prefix, body, suffix string) {
+	if !strings.HasPrefix(text, "\x01") {
+		return "", text, ""
+	}
+
+	inner := strings.TrimSuffix(text[1:], "\x01")
+	i := strings.IndexByte(inner, ' ')
+	if i < 0 || inner[i+1:] == "" {
+		return "", text, ""
+	}
+	return "\x01" + inner[:i+1], inner[i+1:], "\x01"
+}
+
+// selfEvent learns our user and host when the server shows us our own mask
+func (c *Connection) selfEvent(msg *Message, ctx Context) {
+	if msg.Source == nil || msg.Source.Hostname == "" {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.server.EqualFold(msg.Source.Nickname, c.nickname) {
+		c.username, c.hostname = msg.Source.Username, msg.Source.Hostname
+	}
+}
+
+// chghostEvent learns our user and host when the server changes them
+func (c *Connection) chghostEvent(msg *Message, ctx Context) {
+	if msg.Source == nil || len(msg.Params) < 2 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.server.EqualFold(msg.Source.Nickname, c.nickname) {
+		c.username, c.hostname = msg.Params[0], msg.Params[1]
+	}
+}
+
+// visibleHostEvent learns our host when the server changes it
+func (c *Connection) visibleHostEvent(msg *Message, ctx Context) {
+	if len(msg.Params) < 2 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.hostname = msg.Params[1]
+}
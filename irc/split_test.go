@@ -0,0 +1,149 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSplitText(t *testing.T) {
+	Convey("split text should", t, func() {
+		Convey("leave short text alone", func() {
+			So(splitText("hello world", 20), ShouldResemble, []string{"hello world"})
+		})
+
+		Convey("split on spaces", func() {
+			lines := splitText("the quick brown fox jumps over the lazy dog", 12)
+			So(lines, ShouldResemble, []string{"the quick", "brown fox", "jumps over", "the lazy dog"})
+		})
+
+		Convey("split long words between runes", func() {
+			text := strings.Repeat("é", 10)
+			lines := splitText(text, 5)
+			for _, line := range lines {
+				So(len(line), ShouldBeLessThanOrEqualTo, 5)
+				So(utf8.ValidString(line), ShouldBeTrue)
+			}
+			So(strings.Join(lines, ""), ShouldEqual, text)
+		})
+
+		Convey("not split inside a color code", func() {
+			lines := splitText("abcdefgh\x0304,12ijk", 10)
+			So(lines, ShouldResemble, []string{"abcdefgh", "\x0304,12ijk"})
+		})
+
+		Convey("carry formatting over to the next line", func() {
+			lines := splitText("\x02bold \x034red\x1d italic\x0f plain", 16)
+			So(lines, ShouldResemble, []string{
+				"\x02bold \x034red\x1d",
+				"\x02\x1d\x0304italic\x0f",
+				"plain",
+			})
+		})
+
+		Convey("carry hex colors over to the next line", func() {
+			lines := splitText("\x04ff00aa,000000pink text", 18)
+			So(lines, ShouldResemble, []string{"\x04ff00aa,000000pink", "\x04ff00aa,000000text"})
+		})
+	})
+}
+
+func TestConnection_SplitLines(t *testing.T) {
+	Convey("privmsg should split long lines to fit our mask", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.FloodInterval = 0
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		mask := ":anolis!bot@i.am.a.bot "
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+		client.Send(mask + "JOIN #test")
+		So(eventually(func() bool { return ctx.Channels().Has("#test") }), ShouldBeTrue)
+
+		words := strings.Repeat("lorem ipsum dolor sit amet ", 40)
+		ctx.Commands().Privmsg("#test", "%s", words)
+
+		var got []string
+		for len(strings.Join(got, " ")) < len(strings.TrimSpace(words)) {
+			line := client.Expect("PRIVMSG")
+			So(line, ShouldNotBeEmpty)
+			So(len(mask+line+"\r\n"), ShouldBeLessThanOrEqualTo, 512)
+
+			msg, err := ParseMessage(line)
+			So(err, ShouldBeNil)
+			got = append(got, msg.Message)
+		}
+		So(strings.Join(got, " "), ShouldEqual, strings.TrimSpace(words))
+	})
+
+	Convey("privmsg should keep the CTCP framing on each line of a long action", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.FloodInterval = 0
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		mask := ":anolis!bot@i.am.a.bot "
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+		client.Send(mask + "JOIN #test")
+		So(eventually(func() bool { return ctx.Channels().Has("#test") }), ShouldBeTrue)
+
+		words := strings.Repeat("lorem ipsum dolor sit amet ", 40)
+		ctx.Commands().Privmsg("#test", "\x01ACTION %s\x01", words)
+
+		var got []string
+		for len(strings.Join(got, " ")) < len(strings.TrimSpace(words)) {
+			line := client.Expect("PRIVMSG")
+			So(line, ShouldNotBeEmpty)
+			So(len(mask+line+"\r\n"), ShouldBeLessThanOrEqualTo, 512)
+
+			msg, err := ParseMessage(line)
+			So(err, ShouldBeNil)
+			So(msg.Message, ShouldStartWith, "\x01ACTION ")
+			So(msg.Message, ShouldEndWith, "\x01")
+			got = append(got, strings.TrimSuffix(strings.TrimPrefix(msg.Message, "\x01ACTION "), "\x01"))
+		}
+		So(len(got), ShouldBeGreaterThan, 1)
+		So(strings.Join(got, " "), ShouldEqual, strings.TrimSpace(words))
+	})
+}
+
+func TestConnection_TextBudget(t *testing.T) {
+	Convey("a line that fills the text budget should fit when the server relays it", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.FloodInterval = 0
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		mask := ":anolis!bot@i.am.a.bot "
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+		client.Send(mask + "JOIN #test")
+		So(eventually(func() bool { return ctx.Channels().Has("#test") }), ShouldBeTrue)
+
+		text := strings.Repeat("a", ctx.(*Connection).textBudget("PRIVMSG", "#test"))
+		ctx.Commands().Privmsg("#test", "%s", text)
+
+		msg, err := ParseMessage(client.Expect("PRIVMSG"))
+		So(err, ShouldBeNil)
+		So(msg.Params, ShouldResemble, []string{"#test", text})
+
+		relayed := mask + "PRIVMSG #test :" + text + "\r\n"
+		So(len(relayed), ShouldBeLessThanOrEqualTo, 512)
+	})
+}
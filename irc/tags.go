@@ -0,0 +1,88 @@
+package irc
+
+import (
+	"sort"
+	"strings"
+)
+
+// Tags holds IRCv3 message tags, client-only tags keep their '+' prefix
+type Tags map[string]string
+
+// tag values escape these characters
+var (
+	tagEscaper = strings.NewReplacer(
+		"\\", "\\\\", ";", "\\:", " ", "\\s", "\r", "\\r", "\n", "\\n", "\x00", "",
+	)
+	tagUnescapes = map[byte]byte{
+		':': ';', 's': ' ', '\\': '\\', 'r': '\r', 'n': '\n',
+	}
+)
+
+// ParseTags parses the tag section of a message, without the leading '@'
+func ParseTags(raw string) Tags {
+	tags := make(Tags)
+	for _, tag := range strings.Split(raw, ";") {
+		if tag == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(tag, "=")
+		tags[key] = unescapeTag(value)
+	}
+	return tags
+}
+
+// String returns the tags, escaped, as they'd be sent without the leading '@'.
+// NUL can't be escaped so it is stripped from the values
+func (t Tags) String() string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if v := t[k]; v != "" {
+			parts = append(parts, k+"="+tagEscaper.Replace(v))
+		} else {
+			parts = append(parts, k)
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// ClientOnly returns the client-only tags, the ones prefixed with '+'
+func (t Tags) ClientOnly() Tags {
+	out := make(Tags)
+	for k, v := range t {
+		if strings.HasPrefix(k, "+") {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func unescapeTag(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf = append(buf, s[i])
+			continue
+		}
+
+		// a trailing '\' is dropped, an unknown escape is just the character
+		if i++; i < len(s) {
+			if c, ok := tagUnescapes[s[i]]; ok {
+				buf = append(buf, c)
+			} else {
+				buf = append(buf, s[i])
+			}
+		}
+	}
+	return string(buf)
+}
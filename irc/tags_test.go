@@ -0,0 +1,36 @@
+package irc
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTags(t *testing.T) {
+	Convey("tags should", t, func() {
+		Convey("parse keys and values", func() {
+			tags := ParseTags("aaa=bbb;ccc;example.com/ddd=eee;+fff=ggg")
+			So(tags, ShouldResemble, Tags{
+				"aaa": "bbb", "ccc": "", "example.com/ddd": "eee", "+fff": "ggg",
+			})
+		})
+
+		Convey("unescape values", func() {
+			tags := ParseTags(`a=semi\:space\sslash\\cr\rlf\n;b=unknown\b;c=trailing\`)
+			So(tags["a"], ShouldEqual, "semi;space slash\\cr\rlf\n")
+			So(tags["b"], ShouldEqual, "unknownb")
+			So(tags["c"], ShouldEqual, "trailing")
+		})
+
+		Convey("escape values", func() {
+			tags := Tags{"a": "semi;space slash\\cr\rlf\n", "b": ""}
+			So(tags.String(), ShouldEqual, `a=semi\:space\sslash\\cr\rlf\n;b`)
+			So(ParseTags(tags.String()), ShouldResemble, tags)
+		})
+
+		Convey("pick out client-only tags", func() {
+			tags := Tags{"+draft/reply": "abc", "msgid": "def"}
+			So(tags.ClientOnly(), ShouldResemble, Tags{"+draft/reply": "abc"})
+		})
+	})
+}
@@ -0,0 +1,318 @@
+package irc
+
+import "strings"
+
+// Typed events are decoded from a Message once, and only handed to their
+// handlers if the message had everything they need
+
+// PrivmsgEvent is a PRIVMSG sent to a channel or to us
+type PrivmsgEvent struct {
+	From     *User
+	Target   string // the channel, or our nick for a private message
+	Text     string // without the CTCP ACTION wrapping, if IsAction
+	IsAction bool   // whether it was a /me
+
+	Message *Message
+}
+
+// NoticeEvent is a NOTICE sent to a channel or to us
+type NoticeEvent struct {
+	From   *User // the server, for notices from it
+	Target string
+	Text   string
+
+	Message *Message
+}
+
+// JoinEvent is a user, or us, joining a channel
+type JoinEvent struct {
+	Channel string
+	User    *User
+	Account string // with extended-join or account-tag, empty if they aren't logged in
+
+	Message *Message
+}
+
+// PartEvent is a user, or us, leaving a channel
+type PartEvent struct {
+	Channel string
+	User    *User
+	Reason  string
+
+	Message *Message
+}
+
+// QuitEvent is a user leaving the network
+type QuitEvent struct {
+	User   *User
+	Reason string
+
+	Message *Message
+}
+
+// KickEvent is a user, or us, being kicked from a channel
+type KickEvent struct {
+	Channel string
+	By      *User
+	Nick    string // who was kicked
+	Reason  string
+
+	Message *Message
+}
+
+// NickEvent is a user, or us, changing nick
+type NickEvent struct {
+	User *User // with their old nick
+	Nick string
+
+	Message *Message
+}
+
+// TopicEvent is someone changing a channel's topic
+type TopicEvent struct {
+	Channel string
+	By      *User
+	Topic   string
+
+	Message *Message
+}
+
+// ModeEvent is the modes of a channel we're in being changed
+type ModeEvent struct {
+	Channel string
+	Setter  *User // the user, or server, that changed the modes
+	Changes []ModeChange
+
+	Message *Message
+}
+
+// Lookup returns the Channel whose modes changed, from the channels we're in
+func (m *ModeEvent) Lookup(ctx Context) (*Channel, bool) {
+	return ctx.Channels().Get(m.Channel)
+}
+
+// NumericEvent is a numeric reply from the server
+type NumericEvent struct {
+	Code   string   // e.g. "433"
+	Target string   // our nick, or * before we have one
+	Params []string // the params after the target
+
+	Message *Message
+}
+
+// Text returns the last param, which is usually the human readable text
+func (n *NumericEvent) Text() string {
+	if len(n.Params) == 0 {
+		return ""
+	}
+	return n.Params[len(n.Params)-1]
+}
+
+func decodePrivmsg(msg *Message) (*PrivmsgEvent, bool) {
+	if msg.Source == nil || len(msg.Params) < 2 {
+		return nil, false
+	}
+
+	ev := &PrivmsgEvent{From: msg.Source, Target: msg.Params[0], Text: msg.Params[1], Message: msg}
+	if text, ok := strings.CutPrefix(ev.Text, "\x01ACTION"); ok {
+		ev.Text, ev.IsAction = strings.TrimSuffix(strings.TrimPrefix(text, " "), "\x01"), true
+	}
+	return ev, true
+}
+
+func decodeNotice(msg *Message) (*NoticeEvent, bool) {
+	if len(msg.Params) < 2 {
+		return nil, false
+	}
+	return &NoticeEvent{From: msg.Source, Target: msg.Params[0], Text: msg.Params[1], Message: msg}, true
+}
+
+func decodeJoin(msg *Message) (*JoinEvent, bool) {
+	if msg.Source == nil || len(msg.Params) < 1 {
+		return nil, false
+	}
+
+	ev := &JoinEvent{Channel: msg.Params[0], User: msg.Source, Message: msg}
+	if len(msg.Params) > 1 {
+		// extended-join: <channel> <account> :<realname>
+		ev.Account = msg.Params[1]
+	} else {
+		ev.Account = msg.Tags["account"]
+	}
+	if ev.Account == "*" {
+		ev.Account = ""
+	}
+	return ev, true
+}
+
+func decodePart(msg *Message) (*PartEvent, bool) {
+	if msg.Source == nil || len(msg.Params) < 1 {
+		return nil, false
+	}
+
+	ev := &PartEvent{Channel: msg.Params[0], User: msg.Source, Message: msg}
+	if len(msg.Params) > 1 {
+		ev.Reason = msg.Params[1]
+	}
+	return ev, true
+}
+
+func decodeQuit(msg *Message) (*QuitEvent, bool) {
+	if msg.Source == nil {
+		return nil, false
+	}
+
+	ev := &QuitEvent{User: msg.Source, Message: msg}
+	if len(msg.Params) > 0 {
+		ev.Reason = msg.Params[0]
+	}
+	return ev, true
+}
+
+func decodeKick(msg *Message) (*KickEvent, bool) {
+	if len(msg.Params) < 2 {
+		return nil, false
+	}
+
+	ev := &KickEvent{Channel: msg.Params[0], By: msg.Source, Nick: msg.Params[1], Message: msg}
+	if len(msg.Params) > 2 {
+		ev.Reason = msg.Params[2]
+	}
+	return ev, true
+}
+
+func decodeNick(msg *Message) (*NickEvent, bool) {
+	if msg.Source == nil || len(msg.Params) < 1 {
+		return nil, false
+	}
+	return &NickEvent{User: msg.Source, Nick: msg.Params[0], Message: msg}, true
+}
+
+func decodeTopic(msg *Message) (*TopicEvent, bool) {
+	if len(msg.Params) < 2 {
+		return nil, false
+	}
+	return &TopicEvent{Channel: msg.Params[0], By: msg.Source, Topic: msg.Params[1], Message: msg}, true
+}
+
+// decodeMode decodes a MODE message for a channel, it needs the server's CHANMODES and PREFIX
+func decodeMode(msg *Message, ctx Context) (*ModeEvent, bool) {
+	if len(msg.Params) < 2 || !ctx.Server().IsChannel(msg.Params[0]) {
+		return nil, false // a user mode
+	}
+
+	return &ModeEvent{
+		Channel: msg.Params[0],
+		Setter:  msg.Source,
+		Changes: ParseModes(ctx.Server(), msg.Params[1], msg.Params[2:]),
+		Message: msg,
+	}, true
+}
+
+func decodeNumeric(msg *Message) (*NumericEvent, bool) {
+	if !isNumeric(msg.Command) || len(msg.Params) < 1 {
+		return nil, false
+	}
+	return &NumericEvent{Code: msg.Command, Target: msg.Params[0], Params: msg.Params[1:], Message: msg}, true
+}
+
+
+// OnPrivmsg registers fn to be called with each valid PRIVMSG
+func (e *Events) OnPrivmsg(fn func(ev *PrivmsgEvent, ctx Context)) *Handle {
+	return e.Add("PRIVMSG", func(msg *Message, ctx Context) {
+		if ev, ok := decodePrivmsg(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnNotice registers fn to be called with each valid NOTICE
+func (e *Events) OnNotice(fn func(ev *NoticeEvent, ctx Context)) *Handle {
+	return e.Add("NOTICE", func(msg *Message, ctx Context) {
+		if ev, ok := decodeNotice(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnJoin registers fn to be called with each valid JOIN
+func (e *Events) OnJoin(fn func(ev *JoinEvent, ctx Context)) *Handle {
+	return e.Add("JOIN", func(msg *Message, ctx Context) {
+		if ev, ok := decodeJoin(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnPart registers fn to be called with each valid PART
+func (e *Events) OnPart(fn func(ev *PartEvent, ctx Context)) *Handle {
+	return e.Add("PART", func(msg *Message, ctx Context) {
+		if ev, ok := decodePart(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnQuit registers fn to be called with each valid QUIT
+func (e *Events) OnQuit(fn func(ev *QuitEvent, ctx Context)) *Handle {
+	return e.Add("QUIT", func(msg *Message, ctx Context) {
+		if ev, ok := decodeQuit(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnKick registers fn to be called with each valid KICK
+func (e *Events) OnKick(fn func(ev *KickEvent, ctx Context)) *Handle {
+	return e.Add("KICK", func(msg *Message, ctx Context) {
+		if ev, ok := decodeKick(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnNick registers fn to be called with each valid NICK
+func (e *Events) OnNick(fn func(ev *NickEvent, ctx Context)) *Handle {
+	return e.Add("NICK", func(msg *Message, ctx Context) {
+		if ev, ok := decodeNick(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnTopic registers fn to be called with each valid TOPIC
+func (e *Events) OnTopic(fn func(ev *TopicEvent, ctx Context)) *Handle {
+	return e.Add("TOPIC", func(msg *Message, ctx Context) {
+		if ev, ok := decodeTopic(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnMode registers fn to be called with each change to a channel's modes,
+// after the channel has been updated
+func (e *Events) OnMode(fn func(ev *ModeEvent, ctx Context)) *Handle {
+	return e.Add("MODE", func(msg *Message, ctx Context) {
+		if ev, ok := decodeMode(msg, ctx); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnNumeric registers fn to be called with each numeric reply with the code, e.g. "433"
+func (e *Events) OnNumeric(code string, fn func(ev *NumericEvent, ctx Context)) *Handle {
+	return e.Add(code, func(msg *Message, ctx Context) {
+		if ev, ok := decodeNumeric(msg); ok {
+			fn(ev, ctx)
+		}
+	})
+}
+
+// OnHandlerPanic registers fn to be called with the error when an Event panics
+func (e *Events) OnHandlerPanic(fn func(err *HandlerError, ctx Context)) *Handle {
+	return e.Add(HandlerPanicked, func(msg *Message, ctx Context) {
+		if len(msg.Params) == 3 {
+			fn(&HandlerError{Command: msg.Params[0], Panic: msg.Params[1], Stack: msg.Params[2]}, ctx)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package irc
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTypedEvents(t *testing.T) {
+	mock := NewMockConn()
+	Convey("typed events should", t, func() {
+		ev := NewEvents()
+		mock.ev = ev
+		mock.Do(func() { mock.Join("#hello") }, mock.local, "JOIN", "#hello")
+
+		Convey("decode a privmsg", func() {
+			var got *PrivmsgEvent
+			ev.OnPrivmsg(func(e *PrivmsgEvent, ctx Context) { got = e })
+
+			mock.dispatch(":foo!bar@baz PRIVMSG #hello :hello world")
+			So(got.From.Nickname, ShouldEqual, "foo")
+			So(got.Target, ShouldEqual, "#hello")
+			So(got.Text, ShouldEqual, "hello world")
+			So(got.IsAction, ShouldBeFalse)
+
+			mock.dispatch(":foo!bar@baz PRIVMSG anolis :\x01ACTION waves\x01")
+			So(got.Target, ShouldEqual, "anolis")
+			So(got.Text, ShouldEqual, "waves")
+			So(got.IsAction, ShouldBeTrue)
+		})
+
+		Convey("decode a notice", func() {
+			var got *NoticeEvent
+			ev.OnNotice(func(e *NoticeEvent, ctx Context) { got = e })
+
+			mock.dispatch(":irc.localhost NOTICE * :*** Looking up your hostname")
+			So(got.Target, ShouldEqual, "*")
+			So(got.Text, ShouldEqual, "*** Looking up your hostname")
+		})
+
+		Convey("decode a join", func() {
+			var got *JoinEvent
+			ev.OnJoin(func(e *JoinEvent, ctx Context) { got = e })
+
+			mock.dispatch(":foo!bar@baz JOIN #hello")
+			So(got.Channel, ShouldEqual, "#hello")
+			So(got.User.Mask(), ShouldEqual, "foo!bar@baz")
+			So(got.Account, ShouldEqual, "")
+
+			mock.dispatch(":foo!bar@baz JOIN #hello fooacct :Foo Bar")
+			So(got.Account, ShouldEqual, "fooacct")
+
+			mock.dispatch("@account=tagacct :foo!bar@baz JOIN #hello")
+			So(got.Account, ShouldEqual, "tagacct")
+
+			mock.dispatch(":foo!bar@baz JOIN #hello * :Foo Bar")
+			So(got.Account, ShouldEqual, "")
+		})
+
+		Convey("decode a part, quit and kick", func() {
+			var part *PartEvent
+			var quit *QuitEvent
+			var kick *KickEvent
+			ev.OnPart(func(e *PartEvent, ctx Context) { part = e })
+			ev.OnQuit(func(e *QuitEvent, ctx Context) { quit = e })
+			ev.OnKick(func(e *KickEvent, ctx Context) { kick = e })
+
+			mock.dispatch(":foo!bar@baz PART #hello :bye")
+			So(part.Channel, ShouldEqual, "#hello")
+			So(part.Reason, ShouldEqual, "bye")
+
+			mock.dispatch(":foo!bar@baz QUIT")
+			So(quit.User.Nickname, ShouldEqual, "foo")
+			So(quit.Reason, ShouldEqual, "")
+
+			mock.dispatch(":foo!bar@baz KICK #hello qux :spam")
+			So(kick.Channel, ShouldEqual, "#hello")
+			So(kick.By.Nickname, ShouldEqual, "foo")
+			So(kick.Nick, ShouldEqual, "qux")
+			So(kick.Reason, ShouldEqual, "spam")
+		})
+
+		Convey("decode a nick change with the old nick", func() {
+			var got *NickEvent
+			ev.OnNick(func(e *NickEvent, ctx Context) { got = e })
+
+			mock.dispatch(":foo!bar@baz JOIN #hello")
+			mock.dispatch(":foo!bar@baz NICK qux")
+			So(got.User.Nickname, ShouldEqual, "foo")
+			So(got.Nick, ShouldEqual, "qux")
+
+			ch, _ := mock.Channels().Get("#hello")
+			So(ch.Users().HasName("qux"), ShouldBeTrue)
+		})
+
+		Convey("decode a topic", func() {
+			var got *TopicEvent
+			ev.OnTopic(func(e *TopicEvent, ctx Context) { got = e })
+
+			mock.dispatch(":foo!bar@baz TOPIC #hello :new topic")
+			So(got.Channel, ShouldEqual, "#hello")
+			So(got.By.Nickname, ShouldEqual, "foo")
+			So(got.Topic, ShouldEqual, "new topic")
+		})
+
+		Convey("decode a numeric", func() {
+			var got *NumericEvent
+			ev.OnNumeric("433", func(e *NumericEvent, ctx Context) { got = e })
+
+			mock.dispatch(":irc.localhost 433 * anolis :Nickname is already in use")
+			So(got.Code, ShouldEqual, "433")
+			So(got.Target, ShouldEqual, "*")
+			So(got.Params, ShouldResemble, []string{"anolis", "Nickname is already in use"})
+			So(got.Text(), ShouldEqual, "Nickname is already in use")
+		})
+
+		Convey("skip messages missing what they need", func() {
+			called := false
+			ev.OnKick(func(e *KickEvent, ctx Context) { called = true })
+			ev.OnPart(func(e *PartEvent, ctx Context) { called = true })
+			ev.OnPrivmsg(func(e *PrivmsgEvent, ctx Context) { called = true })
+			ev.OnNumeric("001", func(e *NumericEvent, ctx Context) { called = true })
+
+			So(func() {
+				mock.dispatch(":foo!bar@baz KICK #hello")
+				mock.dispatch(":foo!bar@baz PART")
+				mock.dispatch(":foo!bar@baz PRIVMSG #hello")
+				mock.dispatch("PRIVMSG #hello :no source")
+				mock.dispatch(":irc.localhost 001")
+			}, ShouldNotPanic)
+			So(called, ShouldBeFalse)
+		})
+	})
+}
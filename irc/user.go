@@ -7,29 +7,53 @@ type User struct {
 	Nickname string
 	Username string
 	Hostname string
+
+	// filled in by WHO, the account is empty if they aren't logged in
+	Realname string
+	Account  string
+	Away     bool
 }
 
-// NewUser parses a raw string and returns a user
+// NewUser parses a raw 'nick!user@host' string and returns a user,
+// the user and host parts are optional
 func NewUser(raw string) *User {
 	// TODO cache this
-	if strings.Index(raw, "!") == -1 {
-		return &User{Nickname: raw}
-	}
-
-	first := strings.Split(raw, "!")
-	nick, second := first[0], strings.Split(first[1], "@")
-	user, host := second[0], second[1]
-
-	return &User{nick, user, host}
+	u := &User{}
+	raw, u.Hostname, _ = strings.Cut(raw, "@")
+	u.Nickname, u.Username, _ = strings.Cut(raw, "!")
+	return u
 }
 
 func (u *User) String() string {
 	return u.Nickname
 }
 
+// Mask returns the user as a 'nick!user@host' mask, leaving out the parts it doesn't have
+func (u *User) Mask() string {
+	mask := u.Nickname
+	if u.Username != "" {
+		mask += "!" + u.Username
+	}
+	if u.Hostname != "" {
+		mask += "@" + u.Hostname
+	}
+	return mask
+}
+
 // Clone returns a copy of the User
 func (u *User) Clone() *User {
-	return &User{u.Nickname, u.Username, u.Hostname}
+	clone := *u
+	return &clone
+}
+
+// merge copies the username and hostname from a message prefix, if it has them
+func (u *User) merge(prefix *User) {
+	if prefix.Username != "" {
+		u.Username = prefix.Username
+	}
+	if prefix.Hostname != "" {
+		u.Hostname = prefix.Hostname
+	}
 }
 
 // Equals compares the User to another User
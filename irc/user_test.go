@@ -17,6 +17,14 @@ func TestNewUser(t *testing.T) {
 		"irc.localhost": {
 			Nickname: "irc.localhost",
 		},
+		"foo!bar": {
+			Nickname: "foo",
+			Username: "bar",
+		},
+		"foo@irc.localhost": {
+			Nickname: "foo",
+			Hostname: "irc.localhost",
+		},
 	}
 
 	Convey("NewUser should", t, func() {
@@ -1,10 +1,16 @@
 package irc
 
-import "sync"
+import (
+	"strings"
+	"sync"
+)
 
 // Users represents a collection of users
 type Users struct {
-	m map[string]*User
+	m      map[string]*User
+	modes  map[string]string // membership modes, highest rank first
+	server *ServerInfo       // for the casemapping and PREFIX, the defaults if nil
+
 	sync.RWMutex
 }
 
@@ -13,39 +19,78 @@ func (u *Users) Has(user *User) bool {
 	return u.HasName(user.Nickname)
 }
 
-// HasName returns whether user with name is in the collection
+// HasName returns whether user with name is in the collection.
+// The name is compared using the server's casemapping
 func (u *Users) HasName(name string) bool {
 	u.RLock()
 	defer u.RUnlock()
 
-	_, ok := u.m[name]
+	_, ok := u.m[u.key(name)]
 	return ok
 }
 
-// Get returns a user, by name and if they were found
+// Get returns a user, by name and if they were found.
+// The user mustn't be changed, the collection replaces its users rather than changing them,
+// so handlers still holding an older one see it as it was
 func (u *Users) Get(name string) (user *User, ok bool) {
 	u.RLock()
 	defer u.RUnlock()
 
-	user, ok = u.m[name]
+	user, ok = u.m[u.key(name)]
 	return
 }
 
-// Add adds the user to the collection
+// Add adds a copy of the user to the collection
 func (u *Users) Add(user *User) {
 	u.Lock()
 	defer u.Unlock()
 
-	u.m[user.Nickname] = user
+	u.m[u.key(user.Nickname)] = user.Clone()
 }
 
-// Update updates User with the new nick
+// Update stores a copy of User under the new nick
 func (u *Users) Update(nick string, user *User) {
 	u.Lock()
 	defer u.Unlock()
 
-	delete(u.m, user.Nickname) // BUG is this right?
-	u.m[nick] = user           // TODO cache this
+	u.move(user.Nickname, nick, user.Clone())
+}
+
+// seen updates the username and hostname of the user with the prefix's nick from the prefix,
+// keeping what else we know about them, or adds them if they aren't in the collection
+func (u *Users) seen(prefix *User) {
+	_, ok := u.modify(prefix.Nickname, func(user *User) { user.merge(prefix) })
+	if !ok {
+		u.Add(prefix)
+	}
+}
+
+// modify replaces the user with name by a copy that fn changes, moving them,
+// and their membership modes, if fn changed their nick. It returns the copy
+func (u *Users) modify(name string, fn func(user *User)) (*User, bool) {
+	u.Lock()
+	defer u.Unlock()
+
+	user, ok := u.m[u.key(name)]
+	if !ok {
+		return nil, false
+	}
+
+	user = user.Clone()
+	fn(user)
+	u.move(name, user.Nickname, user)
+	return user, true
+}
+
+func (u *Users) move(old, nick string, user *User) {
+	modes := u.modes[u.key(old)]
+	delete(u.m, u.key(old)) // BUG is this right?
+	delete(u.modes, u.key(old))
+
+	u.m[u.key(nick)] = user // TODO cache this
+	if modes != "" {
+		u.putModes(nick, modes)
+	}
 }
 
 // Remove removes the user from the collection
@@ -58,5 +103,81 @@ func (u *Users) RemoveName(name string) {
 	u.Lock()
 	defer u.Unlock()
 
-	delete(u.m, name)
+	delete(u.m, u.key(name))
+	delete(u.modes, u.key(name))
+}
+
+// Modes returns the membership modes of the user with name, highest rank first
+func (u *Users) Modes(name string) string {
+	u.RLock()
+	defer u.RUnlock()
+
+	return u.modes[u.key(name)]
+}
+
+// HasRank returns whether the user with name has the membership mode, or one ranked above it
+func (u *Users) HasRank(name string, mode byte) bool {
+	modes := u.Modes(name)
+	prefix, _ := serverInfo(u.server).Prefix()
+
+	rank := strings.IndexByte(prefix, mode)
+	if rank < 0 {
+		return strings.IndexByte(modes, mode) >= 0
+	}
+	return strings.IndexAny(modes, prefix[:rank+1]) >= 0
+}
+
+// setMode gives or takes the membership mode from the user with name
+func (u *Users) setMode(name string, mode byte, add bool) {
+	u.Lock()
+	defer u.Unlock()
+
+	modes := strings.ReplaceAll(u.modes[u.key(name)], string(mode), "")
+	if add {
+		modes += string(mode)
+	}
+	u.putModes(name, modes)
+}
+
+// setModes replaces the membership modes of the user with name
+func (u *Users) setModes(name, modes string) {
+	u.Lock()
+	defer u.Unlock()
+
+	u.putModes(name, modes)
+}
+
+// putModes stores the modes for the user with name ordered by rank, the lock must be held
+func (u *Users) putModes(name, modes string) {
+	prefix, _ := serverInfo(u.server).Prefix()
+
+	ordered := make([]byte, 0, len(modes))
+	for i := 0; i < len(prefix); i++ {
+		if strings.IndexByte(modes, prefix[i]) >= 0 {
+			ordered = append(ordered, prefix[i])
+		}
+	}
+
+	if len(ordered) == 0 {
+		delete(u.modes, u.key(name))
+		return
+	}
+	if u.modes == nil {
+		u.modes = make(map[string]string)
+	}
+	u.modes[u.key(name)] = string(ordered)
+}
+
+// replace swaps the users and their modes for those in other
+func (u *Users) replace(other *Users) {
+	other.RLock()
+	defer other.RUnlock()
+	u.Lock()
+	defer u.Unlock()
+
+	u.m, u.modes = other.m, other.modes
+}
+
+func (u *Users) key(name string) string {
+	return serverInfo(u.server).Fold(name)
 }
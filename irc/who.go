@@ -0,0 +1,114 @@
+package irc
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// whoxToken marks the WHOX replies to the WHOs we send
+const whoxToken = "616"
+
+// who asks the server about everyone in the channel, using WHOX if it supports it
+func (c *Connection) who(room string) error {
+	if c.server.WHOX() {
+		// token, channel, user, host, nick, flags, account, realname
+		return c.Send(NewMessage("WHO", room, "%tcuhnfar,"+whoxToken))
+	}
+	return c.Send(NewMessage("WHO", room))
+}
+
+// autoWhoEvent sends a WHO for the channels we join, so their users get their hostmasks
+func (c *Connection) autoWhoEvent(msg *Message, ctx Context) {
+	if !c.conf.AutoWho || msg.Source == nil || len(msg.Params) == 0 {
+		return
+	}
+
+	if c.server.EqualFold(msg.Source.Nickname, c.CurrentNick()) {
+		room := msg.Params[0]
+		c.whoLimit.after(func() {
+			if c.isClosed() {
+				return
+			}
+			if err := c.who(room); err != nil {
+				log.Warnf("%s", err)
+			}
+		})
+	}
+}
+
+// whoLimiter spaces out the automatic WHOs, which can have large replies
+type whoLimiter struct {
+	interval time.Duration
+	next     time.Time
+
+	sync.Mutex
+}
+
+// after runs fn once the interval since the last fn has passed
+func (w *whoLimiter) after(fn func()) {
+	w.Lock()
+	defer w.Unlock()
+
+	now := time.Now()
+	if w.next.Before(now) {
+		w.next = now
+	}
+
+	time.AfterFunc(w.next.Sub(now), fn)
+	w.next = w.next.Add(w.interval)
+}
+
+// WhoEvent updates what we know about a user from a WHO reply (352)
+func WhoEvent(msg *Message, ctx Context) {
+	// <client> <channel> <user> <host> <server> <nick> <flags> :<hopcount> <realname>
+	if len(msg.Params) < 8 {
+		return
+	}
+
+	_, realname, _ := strings.Cut(msg.Params[7], " ")
+	updateUser(ctx, msg.Params[1], msg.Params[5], msg.Params[6], func(u *User) {
+		u.Username, u.Hostname, u.Realname = msg.Params[2], msg.Params[3], realname
+	})
+}
+
+// WhoxEvent updates what we know about a user from a reply to our WHOX (354)
+func WhoxEvent(msg *Message, ctx Context) {
+	// <client> <token> <channel> <user> <host> <nick> <flags> <account> :<realname>
+	if len(msg.Params) < 9 || msg.Params[1] != whoxToken {
+		return
+	}
+
+	account := msg.Params[7]
+	if account == "0" {
+		account = "" // not logged in
+	}
+
+	updateUser(ctx, msg.Params[2], msg.Params[5], msg.Params[6], func(u *User) {
+		u.Username, u.Hostname, u.Realname = msg.Params[3], msg.Params[4], msg.Params[8]
+		u.Account = account
+	})
+}
+
+// updateUser applies fn to the user with nick in the channel,
+// and sets their away status and membership modes from the WHO flags
+func updateUser(ctx Context, room, nick, flags string, fn func(u *User)) {
+	ch, ok := ctx.Channels().Get(room)
+	if !ok {
+		return
+	}
+
+	user, ok := ch.Users().modify(nick, func(u *User) {
+		fn(u)
+		u.Away = strings.HasPrefix(flags, "G")
+	})
+	if !ok {
+		return
+	}
+
+	// the flags are H or G, then * for opers, then the membership prefixes
+	flags = strings.TrimLeft(flags, "HG*")
+	modes, _ := ctx.Server().splitPrefix(flags)
+	ch.Users().setModes(nick, modes)
+	log.Debugf("updated '%s' in channel '%s'", user.Mask(), ch.Name)
+}
@@ -0,0 +1,111 @@
+package irc
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConnection_Who(t *testing.T) {
+	mock := NewMockConn()
+	Convey("connection should update users", t, func() {
+		mock.Do(func() { mock.Join("#hello") }, mock.local, "JOIN", "#hello")
+		mock.names("#hello", "anolis bar")
+		ch, _ := mock.Channels().Get("#hello")
+
+		Convey("from a who reply", func() {
+			mock.dispatch(":irc.localhost 352 anolis #hello baz example.com irc.localhost bar G@ :0 Bar Baz")
+			user, _ := ch.Users().Get("bar")
+			So(user.Mask(), ShouldEqual, "bar!baz@example.com")
+			So(user.Realname, ShouldEqual, "Bar Baz")
+			So(user.Away, ShouldBeTrue)
+			So(ch.IsOp("bar"), ShouldBeTrue)
+		})
+
+		Convey("from a whox reply", func() {
+			mock.dispatch(":irc.localhost 354 anolis 616 #hello baz example.com bar H+ barbaz :Bar Baz")
+			user, _ := ch.Users().Get("bar")
+			So(user.Mask(), ShouldEqual, "bar!baz@example.com")
+			So(user.Realname, ShouldEqual, "Bar Baz")
+			So(user.Account, ShouldEqual, "barbaz")
+			So(user.Away, ShouldBeFalse)
+			So(ch.IsVoiced("bar"), ShouldBeTrue)
+
+			Convey("and keep it when they speak", func() {
+				mock.dispatch(":bar!other@elsewhere.com PRIVMSG #hello :hi")
+				user, _ := ch.Users().Get("bar")
+				So(user.Mask(), ShouldEqual, "bar!other@elsewhere.com")
+				So(user.Account, ShouldEqual, "barbaz")
+				So(user.Realname, ShouldEqual, "Bar Baz")
+			})
+
+			Convey("and keep it through a names reply with their host", func() {
+				mock.names("#hello", "anolis +bar!other@elsewhere.com")
+				user, _ := ch.Users().Get("bar")
+				So(user.Mask(), ShouldEqual, "bar!other@elsewhere.com")
+				So(user.Account, ShouldEqual, "barbaz")
+				So(user.Realname, ShouldEqual, "Bar Baz")
+			})
+
+			Convey("and forget their account when logged out", func() {
+				mock.dispatch(":irc.localhost 354 anolis 616 #hello baz example.com bar H 0 :Bar Baz")
+				updated, _ := ch.Users().Get("bar")
+				So(updated.Account, ShouldEqual, "")
+
+				// the user we got before is left as it was
+				So(user.Account, ShouldEqual, "barbaz")
+			})
+		})
+
+		Convey("but not from someone else's whox", func() {
+			mock.dispatch(":irc.localhost 354 anolis 1 #hello baz example.com bar H barbaz :Bar Baz")
+			user, _ := ch.Users().Get("bar")
+			So(user.Account, ShouldEqual, "")
+		})
+	})
+}
+
+func TestDial_Who(t *testing.T) {
+	Convey("dial should", t, func() {
+		srv := newTestServer()
+		defer srv.Close()
+
+		conf := srv.Configuration()
+		conf.WhoInterval = 50 * time.Millisecond
+		conf.FloodInterval = 0
+		ctx, err := Dial(conf)
+		So(err, ShouldBeNil)
+		defer ctx.Connection().Close()
+
+		client := srv.Accept()
+		client.Send(":irc.localhost 001 anolis :Welcome")
+
+		Convey("send a who for the channels it joins", func() {
+			client.Send(":anolis!anolis@localhost JOIN #foo")
+			client.Send(":anolis!anolis@localhost JOIN #bar")
+			So(client.Expect("WHO"), ShouldEqual, "WHO #foo")
+
+			start := time.Now()
+			So(client.Expect("WHO"), ShouldEqual, "WHO #bar")
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 40*time.Millisecond)
+		})
+
+		Convey("use whox when the server supports it", func() {
+			client.Send(":irc.localhost 005 anolis WHOX :are supported by this server")
+			client.Send(":anolis!anolis@localhost JOIN #foo")
+			So(client.Expect("WHO"), ShouldEqual, "WHO #foo %tcuhnfar,616")
+
+			Convey("and refresh a channel on demand", func() {
+				So(eventually(func() bool { return ctx.Channels().Has("#foo") }), ShouldBeTrue)
+				ch, _ := ctx.Channels().Get("#foo")
+				So(ch.Refresh(), ShouldBeNil)
+				So(client.Expect("WHO"), ShouldEqual, "WHO #foo %tcuhnfar,616")
+			})
+		})
+	})
+
+	Convey("a channel without a connection should not refresh", t, func() {
+		So(NewChannel("#foo").Refresh(), ShouldEqual, ErrClosed)
+	})
+}